@@ -14,12 +14,19 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/huynguyenanh2000/url-shorterner/docs"
+	"github.com/huynguyenanh2000/url-shorterner/internal/analytics"
 	"github.com/huynguyenanh2000/url-shorterner/internal/env"
 	"github.com/huynguyenanh2000/url-shorterner/internal/idgen"
+	"github.com/huynguyenanh2000/url-shorterner/internal/metrics"
+	"github.com/huynguyenanh2000/url-shorterner/internal/pkg/bloom"
+	"github.com/huynguyenanh2000/url-shorterner/internal/pkg/canonical"
+	"github.com/huynguyenanh2000/url-shorterner/internal/safety"
 	"github.com/huynguyenanh2000/url-shorterner/internal/store"
 	"github.com/huynguyenanh2000/url-shorterner/internal/store/cache"
+	"github.com/huynguyenanh2000/url-shorterner/internal/tracing"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 )
 
 type application struct {
@@ -27,16 +34,139 @@ type application struct {
 	store        store.Storage
 	cacheStorage cache.Storage
 	idGenerator  idgen.Client
+	codes        idgen.CodeGenerator
+	clicks       analytics.Recorder
 	logger       *zap.SugaredLogger
+
+	linkPasswords *linkPasswordGate
+	safety        safety.Checker
+	canonical     *canonical.Canonicalizer
+	metrics       *metrics.Metrics
+	rateLimits    rateLimiters
+	knownLinks    *bloom.Filter
+
+	// inflight deduplicates concurrent shorten requests of the same long URL
+	inflight singleflight.Group
 }
 
 type config struct {
-	addr      string
-	db        dbConfig
-	env       string
-	machineID int
-	apiURL    string
-	redisCfg  redisConfig
+	addr        string
+	db          dbConfig
+	env         string
+	machineID   int
+	apiURL      string
+	publicURL   string
+	domains     []string
+	redisCfg    redisConfig
+	cacheCfg    cacheConfig
+	clicks      clicksConfig
+	redirect    redirectConfig
+	password    passwordConfig
+	safety      safetyConfig
+	destination destinationConfig
+	canonical   canonicalConfig
+	tracing     tracingConfig
+	rateLimit   rateLimitConfig
+	codes       codeConfig
+}
+
+type codeConfig struct {
+	// One of sequential, random or feistel
+	strategy string
+	// base62, base58, base36 or the characters of a custom alphabet
+	alphabet string
+	// Exact length of random codes, minimum length of the others
+	length int
+	// Key of the feistel permutation, which must never change once links exist
+	secret string
+}
+
+type rateLimitConfig struct {
+	// One of redis, memory or none
+	backend string
+	// Requests to the authenticated API per client IP, counted before the
+	// API key is checked so that guessing keys is limited too
+	auth rateLimitPolicy
+	// Short URLs created per API key, a batch counting each of its URLs, so
+	// that batches larger than the limit are always refused
+	shorten  rateLimitPolicy
+	redirect rateLimitPolicy
+}
+
+// rateLimitPolicy allows requests per client within window, 0 disables it.
+type rateLimitPolicy struct {
+	requests int
+	window   string
+}
+
+type tracingConfig struct {
+	// One of otlp, stdout or none
+	exporter     string
+	otlpEndpoint string
+	// File the stdout exporter writes to instead of stdout
+	file        string
+	sampleRatio float64
+}
+
+type canonicalConfig struct {
+	sortQuery     bool
+	stripTracking bool
+	// Tracking params to strip, a trailing * matches a prefix
+	trackingParams []string
+}
+
+type destinationConfig struct {
+	// Hops followed to resolve links to our own short links, 0 rejects them
+	maxChainDepth int
+	// Domains of other URL shorteners, rejected unless allowed
+	shortenerDomains        []string
+	allowedShortenerDomains []string
+}
+
+type safetyConfig struct {
+	blocklistFile string
+	denylistFile  string
+	lookupURL     string
+	lookupTimeout string
+	// Reject URLs when a safety check fails instead of letting them through
+	failClosed bool
+}
+
+type passwordConfig struct {
+	// Key signing the cookies of unlocked links, random per process if empty
+	cookieSecret string
+	cookieTTL    string
+	// Failed attempts allowed per link within attemptWindow
+	maxAttempts   int
+	attemptWindow string
+	// Whether unlock cookies are only sent over HTTPS. Requests may reach us
+	// in plain HTTP behind a TLS-terminating proxy, so this defaults to the
+	// scheme of the public base URL rather than that of the request
+	secureCookie bool
+}
+
+type redirectConfig struct {
+	// HTTP status of links without their own redirect type
+	status int
+	// Seconds browsers may cache permanent redirects for
+	maxAge int
+}
+
+type cacheConfig struct {
+	// One of redis, memory or none
+	backend string
+	// Maximum number of entries and their TTL for the memory backend
+	size int
+	ttl  string
+	// In-process tier in front of the redis backend, 0 entries disables it
+	localSize int
+	localTTL  string
+	// How long short URLs found missing are remembered, 0 disables it
+	negativeTTL string
+	// Bloom filter of existing short URLs answering misses in process, only
+	// sound on a single replica
+	bloomFilter   bool
+	bloomCapacity int
 }
 
 type redisConfig struct {
@@ -46,6 +176,12 @@ type redisConfig struct {
 	enable bool
 }
 
+type clicksConfig struct {
+	bufferSize    int
+	batchSize     int
+	flushInterval string
+}
+
 type dbConfig struct {
 	addr         string
 	maxOpenConns int
@@ -60,12 +196,14 @@ func (app *application) mount() *chi.Mux {
 	r.Use(middleware.RealIP)
 
 	r.Use(middleware.Logger)
+	r.Use(tracing.Middleware("/metrics", "/v1/health"))
+	r.Use(app.metrics.Middleware)
 	r.Use(middleware.Recoverer)
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{env.GetString("CORS_ALLOWED_ORIGIN", "http://localhost:5174")},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link", "Location"},
+		ExposedHeaders:   []string{"Link", "Location", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"},
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
@@ -80,14 +218,46 @@ func (app *application) mount() *chi.Mux {
 		))
 
 		r.Route("/urls", func(r chi.Router) {
-			r.Post("/shorten", app.urlShortenHandler)
+			authLimit := app.rateLimitMiddleware(app.rateLimits.auth)
+
+			r.With(authLimit, app.apiKeyAuthMiddleware).Get("/", app.listURLsHandler)
+			r.With(authLimit, app.apiKeyAuthMiddleware, app.rateLimitMiddleware(app.rateLimits.shorten)).Post("/shorten", app.urlShortenHandler)
+			// Batches are limited per URL once read
+			r.With(authLimit, app.apiKeyAuthMiddleware).Post("/shorten/batch", app.urlShortenBatchHandler)
 			r.Route("/{shortURL}", func(r chi.Router) {
-				r.Use(app.urlContextMiddleware)
-				r.Get("/", app.urlRedirectHandler)
+				r.Use(app.shortURLMiddleware)
+
+				// Redirects are limited before the lookup, so that scanning
+				// for codes does not reach the database
+				r.With(app.rateLimitMiddleware(app.rateLimits.redirect), app.urlContextMiddleware, app.linkPasswordMiddleware).Get("/", app.urlRedirectHandler)
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.urlContextMiddleware)
+					r.Post("/", app.urlPasswordHandler)
+					r.Get("/qr", app.urlQRCodeHandler)
+
+					r.Group(func(r chi.Router) {
+						r.Use(authLimit)
+						r.Use(app.apiKeyAuthMiddleware)
+						r.Use(app.urlOwnerMiddleware)
+
+						r.Get("/info", app.urlInfoHandler)
+						r.Get("/stats", app.urlStatsHandler)
+						r.Patch("/", app.updateURLHandler)
+						r.Delete("/", app.deleteURLHandler)
+					})
+				})
 			})
 		})
 	})
 
+	r.Handle("/metrics", app.metrics.Handler())
+
+	// Short links are also served from the root so that vanity aliases read
+	// naturally, e.g. /spring-sale
+	r.With(app.shortURLMiddleware, app.rateLimitMiddleware(app.rateLimits.redirect), app.urlContextMiddleware, app.linkPasswordMiddleware).Get("/{shortURL}", app.urlRedirectHandler)
+	r.With(app.shortURLMiddleware, app.urlContextMiddleware).Post("/{shortURL}", app.urlPasswordHandler)
+
 	return r
 }
 
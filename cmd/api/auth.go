@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/huynguyenanh2000/url-shorterner/internal/store"
+)
+
+type apiKeyKey string
+
+const apiKeyCtx apiKeyKey = "apiKey"
+
+var (
+	errMissingAPIKey = errors.New("missing api key")
+	errInvalidAPIKey = errors.New("invalid api key")
+	errNotURLOwner   = errors.New("url is owned by another api key")
+)
+
+// apiKeyAuthMiddleware requires a valid API key in the Authorization header,
+// sent as "Bearer <key>".
+func (app *application) apiKeyAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			app.unauthorizedResponse(w, r, errMissingAPIKey)
+			return
+		}
+
+		scheme, key, ok := strings.Cut(authHeader, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || key == "" {
+			app.unauthorizedResponse(w, r, errInvalidAPIKey)
+			return
+		}
+
+		ctx := r.Context()
+
+		apiKey, err := app.store.APIKeys.GetByHash(ctx, store.HashAPIKey(key))
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.unauthorizedResponse(w, r, errInvalidAPIKey)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, apiKeyCtx, apiKey)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// urlOwnerMiddleware only lets the owner of the URL in context through. It
+// must run after both apiKeyAuthMiddleware and urlContextMiddleware.
+func (app *application) urlOwnerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := getURLFromCtx(r)
+		apiKey := getAPIKeyFromCtx(r)
+
+		if url.OwnerID != apiKey.ID {
+			app.forbiddenResponse(w, r, errNotURLOwner)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func getAPIKeyFromCtx(r *http.Request) *store.APIKey {
+	apiKey, _ := r.Context().Value(apiKeyCtx).(*store.APIKey)
+	return apiKey
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/huynguyenanh2000/url-shorterner/internal/store"
+)
+
+const (
+	batchStatusCreated  = "created"
+	batchStatusExisting = "existing"
+	batchStatusInvalid  = "invalid"
+	batchStatusBlocked  = "blocked"
+)
+
+type ShorternURLsBatchPayload struct {
+	LongURLs []string `json:"long_urls" validate:"required,min=1,max=100"`
+	// Branded domain serving the links, defaults to the domain of the API
+	Domain string `json:"domain,omitempty" validate:"omitempty,hostname_rfc1123"`
+}
+
+type BatchShortenResult struct {
+	LongURL string `json:"long_url"`
+	// One of created, existing, invalid or blocked
+	Status string       `json:"status"`
+	URL    *URLResponse `json:"url,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// Shortern URLs in batch godoc
+//
+//	@Summary		Shortern URLs in batch
+//	@Description	Shortern up to 100 URLs at once, with a result per URL in the same order. Each URL counts against the rate limit of shortening
+//	@Tags			urls
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ShorternURLsBatchPayload	true	"URLs payload"
+//	@Success		200		{array}		BatchShortenResult
+//	@Failure		400		{object}	error	"Invalid payload or unknown domain"
+//	@Failure		401		{object}	error
+//	@Failure		429		{object}	error	"Rate limit exceeded"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/urls/shorten/batch [post]
+func (app *application) urlShortenBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ShorternURLsBatchPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if !app.allowRequests(w, r, app.rateLimits.shorten, len(payload.LongURLs)) {
+		return
+	}
+
+	domain, err := app.payloadDomain(payload.Domain)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	ownerID := getAPIKeyFromCtx(r).ID
+
+	results := make([]BatchShortenResult, len(payload.LongURLs))
+
+	// Index of the first result of each long URL, so duplicates in the batch
+	// share a single short URL
+	firstResult := make(map[string]int, len(payload.LongURLs))
+
+	var (
+		newURLs []*store.URL
+		// Result index of each new URL
+		newIdx []int
+	)
+	for i, longURL := range payload.LongURLs {
+		results[i].LongURL = longURL
+
+		if err := Validate.Var(longURL, "required,http_url"); err != nil {
+			results[i].Status = batchStatusInvalid
+			results[i].Error = err.Error()
+			continue
+		}
+
+		if _, ok := firstResult[longURL]; ok {
+			continue
+		}
+		firstResult[longURL] = i
+
+		destination, err := app.validateDestination(ctx, longURL)
+		if err != nil {
+			if !isRejectedDestination(err) {
+				app.internalServerError(w, r, err)
+				return
+			}
+
+			results[i].Status = batchStatusBlocked
+			results[i].Error = err.Error()
+			continue
+		}
+
+		existingURL, err := app.findExistingURL(ctx, ownerID, domain, destination)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if existingURL != nil {
+			results[i].Status = batchStatusExisting
+			results[i].URL = app.urlResponse(existingURL)
+			continue
+		}
+
+		url := &store.URL{
+			OwnerID: ownerID,
+			Domain:  domain,
+			LongURL: destination,
+		}
+		app.assignShortURL(url)
+
+		results[i].Status = batchStatusCreated
+		results[i].URL = app.urlResponse(url)
+		newURLs = append(newURLs, url)
+		newIdx = append(newIdx, i)
+	}
+
+	if len(newURLs) > 0 {
+		if err := app.createBatch(ctx, results, newURLs, newIdx); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	// Duplicates within the batch share the result of their first occurrence,
+	// whose URL exists by now if it was created
+	for i := range results {
+		first, ok := firstResult[results[i].LongURL]
+		if !ok || first == i {
+			continue
+		}
+
+		results[i] = results[first]
+		if results[i].Status == batchStatusCreated {
+			results[i].Status = batchStatusExisting
+		}
+	}
+
+	if err := jsonResponse(w, http.StatusOK, results); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// createBatch stores newURLs, whose results are at newIdx, with a single
+// insert and a single cache pipeline.
+func (app *application) createBatch(ctx context.Context, results []BatchShortenResult, newURLs []*store.URL, newIdx []int) error {
+	app.addKnownLinks(newURLs...)
+
+	// Save to DB
+	err := app.store.URL.CreateMany(ctx, newURLs)
+	if errors.Is(err, store.ErrDuplicateLongURL) || errors.Is(err, store.ErrConflict) {
+		// Some long URLs were shortened concurrently or some short codes are
+		// taken, so nothing was inserted. Fall back to creating them one by
+		// one, picking up the winners' rows and drawing new codes
+		for _, i := range newIdx {
+			res, err := app.findOrCreateURL(ctx, results[i].URL.URL)
+			if err != nil {
+				return err
+			}
+
+			results[i].URL = app.urlResponse(res.url)
+			if !res.created {
+				results[i].Status = batchStatusExisting
+			}
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Save to cache
+	return app.cacheStorage.URL.SetMany(ctx, newURLs)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/huynguyenanh2000/url-shorterner/internal/pkg/bloom"
+	"github.com/huynguyenanh2000/url-shorterner/internal/store"
+)
+
+const (
+	bloomFalsePositiveRate = 0.01
+	bloomLoadPageSize      = 1000
+)
+
+// newKnownLinks returns a Bloom filter of the short URLs of all links in
+// the database, nil if disabled. Links created by other replicas never reach
+// the filter, so it is only sound on a single replica.
+func newKnownLinks(ctx context.Context, cfg cacheConfig, st store.Storage) (*bloom.Filter, error) {
+	if !cfg.bloomFilter {
+		return nil, nil
+	}
+	if cfg.backend == "redis" {
+		return nil, errors.New("bloom filter only serves a single replica, which does not use the redis cache backend")
+	}
+
+	filter := bloom.New(cfg.bloomCapacity, bloomFalsePositiveRate)
+
+	var cursor uint64
+	for {
+		urls, err := st.URL.ListAll(ctx, cursor, bloomLoadPageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, url := range urls {
+			filter.Add(linkKey(url.Domain, url.ShortURL))
+		}
+
+		if len(urls) < bloomLoadPageSize {
+			return filter, nil
+		}
+		cursor = urls[len(urls)-1].ID
+	}
+}
+
+// addKnownLinks adds urls to the filter of known short URLs, if enabled. It
+// must be called before urls are created, so that no lookup finds them
+// missing.
+func (app *application) addKnownLinks(urls ...*store.URL) {
+	if app.knownLinks == nil {
+		return
+	}
+
+	for _, url := range urls {
+		app.knownLinks.Add(linkKey(url.Domain, url.ShortURL))
+	}
+}
+
+// unknownLink reports whether no link exists at shortURL on domain for sure.
+func (app *application) unknownLink(domain, shortURL string) bool {
+	return app.knownLinks != nil && !app.knownLinks.Test(linkKey(domain, shortURL))
+}
+
+func linkKey(domain, shortURL string) string {
+	return domain + "/" + shortURL
+}
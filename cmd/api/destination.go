@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/huynguyenanh2000/url-shorterner/internal/store"
+)
+
+var (
+	errSelfReferentialURL = errors.New("long_url points at this service but not at a short link that can be followed")
+	errLinkChainTooDeep   = errors.New("long_url is a chain of short links that is too long")
+	errShortenerDomain    = errors.New("long_url points at another URL shortener")
+)
+
+// validateDestination returns the URL a new link to longURL must store, in
+// canonical form. Links to our own short links, on any of our domains, are
+// resolved to their target, up to maxChainDepth hops, so that redirects never
+// chain or loop. Links to other
+// shorteners are rejected unless their domain is allowed. The destination is
+// then run through the safety checks.
+func (app *application) validateDestination(ctx context.Context, longURL string) (string, error) {
+	for depth := 0; ; depth++ {
+		canonicalURL, err := app.canonical.URL(longURL)
+		if err != nil {
+			return "", err
+		}
+		longURL = canonicalURL
+
+		host, path, err := splitURL(longURL)
+		if err != nil {
+			return "", err
+		}
+
+		domain, own := app.domainOf(host)
+		if !own {
+			if app.isOtherShortener(host) {
+				return "", errShortenerDomain
+			}
+			break
+		}
+
+		if depth >= app.config.destination.maxChainDepth {
+			if depth == 0 {
+				return "", errSelfReferentialURL
+			}
+			return "", errLinkChainTooDeep
+		}
+
+		target, err := app.resolveShortLink(ctx, domain, path)
+		if err != nil {
+			return "", err
+		}
+		longURL = target
+	}
+
+	if err := app.checkDestination(ctx, longURL); err != nil {
+		return "", err
+	}
+
+	return longURL, nil
+}
+
+// resolveShortLink returns the target of the short link served at path on
+// domain. Links whose redirect is gated in any way are not resolved, since
+// the new link would skip the gate.
+func (app *application) resolveShortLink(ctx context.Context, domain, path string) (string, error) {
+	shortURL := app.shortLinkPath(path)
+	if !app.validShortURL(shortURL) {
+		return "", errSelfReferentialURL
+	}
+
+	link, err := app.getURL(ctx, domain, shortURL)
+	if errors.Is(err, store.ErrNotFound) {
+		return "", errSelfReferentialURL
+	} else if err != nil {
+		return "", err
+	}
+
+	if link.ExpiresAt != nil || link.HasPassword() || link.MaxClicks != nil || link.IsFlagged() {
+		return "", errSelfReferentialURL
+	}
+
+	return link.LongURL, nil
+}
+
+// isOtherShortener reports whether host is, or is a subdomain of, a known
+// URL shortener domain that is not explicitly allowed.
+func (app *application) isOtherShortener(host string) bool {
+	return matchesDomain(host, app.config.destination.shortenerDomains) &&
+		!matchesDomain(host, app.config.destination.allowedShortenerDomains)
+}
+
+// splitURL returns the lowercased host name, without port, and the path of
+// rawURL.
+func splitURL(rawURL string) (string, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), "."), u.Path, nil
+}
+
+func matchesDomain(host string, domains []string) bool {
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// destinationErrorResponse answers a failed validateDestination.
+func (app *application) destinationErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	if isRejectedDestination(err) {
+		app.unprocessableEntityResponse(w, r, err)
+		return
+	}
+
+	app.internalServerError(w, r, err)
+}
+
+// isRejectedDestination reports whether err is why a destination was refused,
+// as opposed to a failure while checking it.
+func isRejectedDestination(err error) bool {
+	return errors.Is(err, errUnsafeDestination) ||
+		errors.Is(err, errSelfReferentialURL) ||
+		errors.Is(err, errLinkChainTooDeep) ||
+		errors.Is(err, errShortenerDomain)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/huynguyenanh2000/url-shorterner/internal/store"
+)
+
+var errUnknownDomain = errors.New("domain is not served by this deployment")
+
+// domainOf returns the domain links served at host are stored under: empty
+// for the default domain, i.e. the host of the public base URL or of the API,
+// the host itself for a branded domain. It returns false if host is none of
+// them.
+func (app *application) domainOf(host string) (string, bool) {
+	host = normalizeHost(host)
+
+	switch {
+	case host == hostOf(app.publicBase()) || host == hostOf(app.apiBase()):
+		return "", true
+	case slices.Contains(app.config.domains, host):
+		return host, true
+	}
+
+	return "", false
+}
+
+// requestDomain returns the domain of the short link a request is about. It
+// is taken from the domain query param if set, so that links of any domain
+// can be managed through the API host, and from the Host header otherwise.
+// Requests to hosts that are not ours, e.g. an IP, are served from the
+// default domain.
+func (app *application) requestDomain(r *http.Request) (string, bool) {
+	if domain := r.URL.Query().Get("domain"); domain != "" {
+		return app.domainOf(domain)
+	}
+
+	domain, _ := app.domainOf(r.Host)
+	return domain, true
+}
+
+// payloadDomain returns the domain a new link requested on domain is stored
+// under, the default one if empty.
+func (app *application) payloadDomain(domain string) (string, error) {
+	if domain == "" {
+		return "", nil
+	}
+
+	domain, ok := app.domainOf(domain)
+	if !ok {
+		return "", errUnknownDomain
+	}
+
+	return domain, nil
+}
+
+// shortLink returns the public URL of a short code on domain, served from
+// the root of the public base URL so that vanity aliases read naturally.
+// Branded domains are served with the scheme and path prefix of the public
+// base URL.
+func (app *application) shortLink(domain, shortURL string) string {
+	base := app.publicBase()
+	if domain != "" {
+		base.Host = domain
+	}
+
+	return strings.TrimSuffix(base.String(), "/") + "/" + shortURL
+}
+
+// shortLinkPath returns the short code of the short link at path, which is
+// either a short link or an API URL of one, on a host of ours.
+func (app *application) shortLinkPath(path string) string {
+	prefix := strings.TrimSuffix(app.publicBase().Path, "/")
+	if p, ok := strings.CutPrefix(path, prefix+"/"); ok && prefix != "" {
+		path = p
+	}
+
+	return strings.TrimPrefix(strings.Trim(path, "/"), "v1/urls/")
+}
+
+// publicBase returns the URL short links are served under, which may have a
+// path prefix when the service sits behind a proxy. It defaults to the URL of
+// the API.
+func (app *application) publicBase() *url.URL {
+	if app.config.publicURL == "" {
+		return app.apiBase()
+	}
+
+	return parseBase(app.config.publicURL)
+}
+
+func (app *application) apiBase() *url.URL {
+	return parseBase(app.config.apiURL)
+}
+
+// parseBase parses a base URL, which defaults to http when it has no scheme.
+func parseBase(base string) *url.URL {
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		return &url.URL{}
+	}
+
+	return u
+}
+
+func hostOf(u *url.URL) string {
+	return normalizeHost(u.Host)
+}
+
+// normalizeHost lowercases host and strips its port and trailing dot.
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// URLResponse is a URL along with its full short link.
+type URLResponse struct {
+	*store.URL
+	// Short link to share, on the domain of the URL
+	Link string `json:"link"`
+}
+
+func (app *application) urlResponse(url *store.URL) *URLResponse {
+	return &URLResponse{URL: url, Link: app.shortLink(url.Domain, url.ShortURL)}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"net/http"
+	"strconv"
 )
 
 func (app *application) internalServerError(w http.ResponseWriter, r *http.Request, err error) {
@@ -21,3 +22,41 @@ func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request,
 
 	writeJsonError(w, http.StatusNotFound, "not found")
 }
+
+func (app *application) conflictResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("conflict response", "method", r.Method, "path", r.URL.Path, "error", err)
+
+	writeJsonError(w, http.StatusConflict, err.Error())
+}
+
+func (app *application) goneResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("gone response", "method", r.Method, "path", r.URL.Path, "error", err)
+
+	writeJsonError(w, http.StatusGone, err.Error())
+}
+
+func (app *application) unauthorizedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("unauthorized error", "method", r.Method, "path", r.URL.Path, "error", err)
+
+	w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+	writeJsonError(w, http.StatusUnauthorized, "unauthorized")
+}
+
+func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("forbidden error", "method", r.Method, "path", r.URL.Path, "error", err)
+
+	writeJsonError(w, http.StatusForbidden, "forbidden")
+}
+
+func (app *application) unprocessableEntityResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("unprocessable entity", "method", r.Method, "path", r.URL.Path, "error", err)
+
+	writeJsonError(w, http.StatusUnprocessableEntity, err.Error())
+}
+
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter int) {
+	app.logger.Warnw("rate limit exceeded", "method", r.Method, "path", r.URL.Path, "ip", clientIP(r), "error", errRateLimited)
+
+	w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+	writeJsonError(w, http.StatusTooManyRequests, errRateLimited.Error())
+}
@@ -11,6 +11,8 @@ var Validate *validator.Validate
 
 func init() {
 	Validate = validator.New(validator.WithRequiredStructEnabled())
+	_ = Validate.RegisterValidation("alias", validateAlias)
+	_ = Validate.RegisterValidation("password", validatePassword)
 }
 
 func writeJson(w http.ResponseWriter, status int, data any) error {
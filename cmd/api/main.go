@@ -1,11 +1,24 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/huynguyenanh2000/url-shorterner/internal/analytics"
 	"github.com/huynguyenanh2000/url-shorterner/internal/db"
 	"github.com/huynguyenanh2000/url-shorterner/internal/env"
 	"github.com/huynguyenanh2000/url-shorterner/internal/idgen"
+	"github.com/huynguyenanh2000/url-shorterner/internal/metrics"
+	"github.com/huynguyenanh2000/url-shorterner/internal/pkg/alphabet"
+	"github.com/huynguyenanh2000/url-shorterner/internal/pkg/canonical"
+	"github.com/huynguyenanh2000/url-shorterner/internal/safety"
 	"github.com/huynguyenanh2000/url-shorterner/internal/store"
 	"github.com/huynguyenanh2000/url-shorterner/internal/store/cache"
+	"github.com/huynguyenanh2000/url-shorterner/internal/tracing"
 	"github.com/joho/godotenv"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
@@ -37,9 +50,13 @@ func main() {
 
 	_ = godotenv.Load()
 
+	publicURL := env.GetString("PUBLIC_BASE_URL", env.GetString("EXTERNAL_URL", "localhost:8080"))
+
 	cfg := config{
 		addr:      env.GetString("ADDR", ":8080"),
 		apiURL:    env.GetString("EXTERNAL_URL", "localhost:8080"),
+		publicURL: publicURL,
+		domains:   env.GetList("DOMAINS", ""),
 		machineID: env.GetInt("MACHINE_ID", 1),
 		db: dbConfig{
 			addr:         env.GetString("DB_ADDR", "admin:adminpassword@tcp(localhost:3306)/url_shorterner?parseTime=true"),
@@ -53,9 +70,107 @@ func main() {
 			db:     env.GetInt("REDIS_DB", 0),
 			enable: env.GetBool("REDIS_ENABLE", true),
 		},
+		cacheCfg: cacheConfig{
+			backend: env.GetString("CACHE_BACKEND", defaultRedisBackend()),
+			size:    env.GetInt("CACHE_SIZE", 10000),
+			ttl:     env.GetString("CACHE_TTL", "10m"),
+
+			localSize:     env.GetInt("CACHE_LOCAL_SIZE", 0),
+			localTTL:      env.GetString("CACHE_LOCAL_TTL", "5s"),
+			negativeTTL:   env.GetString("CACHE_NEGATIVE_TTL", "30s"),
+			bloomFilter:   env.GetBool("CACHE_BLOOM_FILTER", false),
+			bloomCapacity: env.GetInt("CACHE_BLOOM_CAPACITY", 1000000),
+		},
+		clicks: clicksConfig{
+			bufferSize:    env.GetInt("CLICKS_BUFFER_SIZE", 10000),
+			batchSize:     env.GetInt("CLICKS_BATCH_SIZE", 500),
+			flushInterval: env.GetString("CLICKS_FLUSH_INTERVAL", "5s"),
+		},
+		redirect: redirectConfig{
+			status: env.GetInt("REDIRECT_STATUS", http.StatusPermanentRedirect),
+			maxAge: env.GetInt("REDIRECT_MAX_AGE", 86400),
+		},
+		password: passwordConfig{
+			cookieSecret:  env.GetString("LINK_PASSWORD_SECRET", ""),
+			cookieTTL:     env.GetString("LINK_PASSWORD_COOKIE_TTL", "1h"),
+			maxAttempts:   env.GetInt("LINK_PASSWORD_MAX_ATTEMPTS", 5),
+			attemptWindow: env.GetString("LINK_PASSWORD_ATTEMPT_WINDOW", "15m"),
+			secureCookie:  env.GetBool("LINK_PASSWORD_SECURE_COOKIE", strings.HasPrefix(publicURL, "https://")),
+		},
+		safety: safetyConfig{
+			blocklistFile: env.GetString("SAFETY_BLOCKLIST_FILE", ""),
+			denylistFile:  env.GetString("SAFETY_DENYLIST_FILE", ""),
+			lookupURL:     env.GetString("SAFETY_LOOKUP_URL", ""),
+			lookupTimeout: env.GetString("SAFETY_LOOKUP_TIMEOUT", "2s"),
+			failClosed:    env.GetBool("SAFETY_FAIL_CLOSED", false),
+		},
+		destination: destinationConfig{
+			maxChainDepth:           env.GetInt("LINK_CHAIN_MAX_DEPTH", 3),
+			shortenerDomains:        env.GetList("SHORTENER_DOMAINS", defaultShortenerDomains),
+			allowedShortenerDomains: env.GetList("SHORTENER_ALLOWED_DOMAINS", ""),
+		},
+		canonical: canonicalConfig{
+			sortQuery:      env.GetBool("CANONICAL_SORT_QUERY", false),
+			stripTracking:  env.GetBool("CANONICAL_STRIP_TRACKING", false),
+			trackingParams: env.GetList("CANONICAL_TRACKING_PARAMS", strings.Join(canonical.DefaultTrackingParams, ",")),
+		},
+		tracing: tracingConfig{
+			exporter:     env.GetString("TRACING_EXPORTER", "none"),
+			otlpEndpoint: env.GetString("TRACING_OTLP_ENDPOINT", ""),
+			file:         env.GetString("TRACING_FILE", ""),
+			sampleRatio:  env.GetFloat("TRACING_SAMPLE_RATIO", 1),
+		},
+		rateLimit: rateLimitConfig{
+			backend: env.GetString("RATE_LIMIT_BACKEND", defaultRedisBackend()),
+			auth: rateLimitPolicy{
+				requests: env.GetInt("RATE_LIMIT_AUTH_REQUESTS", 300),
+				window:   env.GetString("RATE_LIMIT_AUTH_WINDOW", "1m"),
+			},
+			shorten: rateLimitPolicy{
+				requests: env.GetInt("RATE_LIMIT_SHORTEN_REQUESTS", 100),
+				window:   env.GetString("RATE_LIMIT_SHORTEN_WINDOW", "1m"),
+			},
+			redirect: rateLimitPolicy{
+				requests: env.GetInt("RATE_LIMIT_REDIRECT_REQUESTS", 600),
+				window:   env.GetString("RATE_LIMIT_REDIRECT_WINDOW", "1m"),
+			},
+		},
+		codes: codeConfig{
+			strategy: env.GetString("CODE_STRATEGY", "sequential"),
+			alphabet: env.GetString("CODE_ALPHABET", "base62"),
+			length:   env.GetInt("CODE_LENGTH", 8),
+			secret:   env.GetString("CODE_SECRET", ""),
+		},
 		env: env.GetString("ENV", "development"),
 	}
 
+	if !isRedirectStatus(cfg.redirect.status) {
+		logger.Fatalw("invalid REDIRECT_STATUS", "status", cfg.redirect.status)
+	}
+
+	// Tracing, set up first so that the database and Redis clients trace
+	// with the configured provider
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:       cfg.tracing.exporter,
+		OTLPEndpoint:   cfg.tracing.otlpEndpoint,
+		File:           cfg.tracing.file,
+		SampleRatio:    cfg.tracing.sampleRatio,
+		ServiceName:    "url-shorterner",
+		ServiceVersion: version,
+	})
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Errorw("failed to flush traces", "error", err)
+		}
+	}()
+	logger.Infow("tracing initialized", "exporter", cfg.tracing.exporter)
+
 	// Database
 	db, err := db.New(
 		cfg.db.addr,
@@ -73,7 +188,10 @@ func main() {
 	// Cache
 	var rdb *redis.Client
 	if cfg.redisCfg.enable {
-		rdb = cache.NewRedisClient(cfg.redisCfg.addr, cfg.redisCfg.pw, cfg.redisCfg.db)
+		rdb, err = cache.NewRedisClient(cfg.redisCfg.addr, cfg.redisCfg.pw, cfg.redisCfg.db)
+		if err != nil {
+			logger.Fatal(err)
+		}
 		logger.Info("redis cache connection established")
 
 		defer rdb.Close()
@@ -83,18 +201,165 @@ func main() {
 	if err != nil {
 		logger.Fatal(err)
 	}
-	store := store.NewStorage(db)
-	cacheStorage := cache.NewRedisStorage(rdb)
+	codes, err := newCodeGenerator(cfg.codes)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Infow("short code generator initialized", "strategy", cfg.codes.strategy)
+
+	canon := canonical.New(canonical.Options{
+		SortQuery:      cfg.canonical.sortQuery,
+		StripTracking:  cfg.canonical.stripTracking,
+		TrackingParams: cfg.canonical.trackingParams,
+	})
+	appMetrics := metrics.New(db)
+	store := store.NewStorage(db, canon, appMetrics)
+
+	cacheStorage, err := newCacheStorage(cfg.cacheCfg, rdb)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Infow("cache storage initialized", "backend", cfg.cacheCfg.backend)
+
+	knownLinks, err := newKnownLinks(context.Background(), cfg.cacheCfg, store)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if knownLinks != nil {
+		logger.Info("bloom filter of short URLs loaded")
+	}
+
+	// Click analytics
+	flushInterval, err := time.ParseDuration(cfg.clicks.flushInterval)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	clickRecorder := analytics.NewBatchRecorder(store, logger, cfg.clicks.bufferSize, cfg.clicks.batchSize, flushInterval)
+	defer clickRecorder.Close()
+
+	// Password-protected links
+	linkPasswords, err := newLinkPasswordGate(cfg.password, rdb, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if cfg.password.cookieSecret == "" {
+		logger.Warn("LINK_PASSWORD_SECRET is not set, unlocked links will be locked again on restart")
+	}
+
+	// Destination safety checks
+	safetyChecker, err := newSafetyChecker(cfg.safety)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	// Rate limiting
+	rateLimits, err := newRateLimiters(cfg.rateLimit, rdb, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Infow("rate limiting initialized", "backend", cfg.rateLimit.backend)
 
 	app := &application{
 		config:       cfg,
 		store:        store,
 		cacheStorage: cacheStorage,
-		idGenerator:  snowflakeIDGenerator,
+		idGenerator:  appMetrics.InstrumentIDGenerator(snowflakeIDGenerator),
+		codes:        codes,
+		clicks:       clickRecorder,
 		logger:       logger,
+
+		linkPasswords: linkPasswords,
+		safety:        safetyChecker,
+		canonical:     canon,
+		metrics:       appMetrics,
+		rateLimits:    rateLimits,
+		knownLinks:    knownLinks,
 	}
 
 	mux := app.mount()
 
-	logger.Fatal(app.run(mux))
+	if err := app.run(mux); err != nil {
+		logger.Fatal(err)
+	}
+}
+
+// defaultShortenerDomains are well-known URL shorteners. Links to them hide
+// their destination from our safety checks, and may chain further.
+const defaultShortenerDomains = "bit.ly,bitly.com,tinyurl.com,t.co,goo.gl,ow.ly,is.gd,v.gd,buff.ly,rebrand.ly,cutt.ly,shorturl.at,tiny.cc,rb.gy,t.ly,s.id"
+
+// defaultRedisBackend is the default backend of state that can live in Redis,
+// such as the cache and rate limits: Redis when it is enabled, so that
+// replicas share it, and an in-process one otherwise.
+func defaultRedisBackend() string {
+	if env.GetBool("REDIS_ENABLE", true) {
+		return "redis"
+	}
+
+	return "memory"
+}
+
+func newCacheStorage(cfg cacheConfig, rdb *redis.Client) (cache.Storage, error) {
+	negativeTTL, err := time.ParseDuration(cfg.negativeTTL)
+	if err != nil {
+		return cache.Storage{}, err
+	}
+
+	switch cfg.backend {
+	case "redis":
+		if rdb == nil {
+			return cache.Storage{}, errors.New("cache backend redis requires REDIS_ENABLE=true")
+		}
+		if cfg.localSize <= 0 {
+			return cache.NewRedisStorage(rdb, negativeTTL), nil
+		}
+
+		localTTL, err := time.ParseDuration(cfg.localTTL)
+		if err != nil {
+			return cache.Storage{}, err
+		}
+		return cache.NewTieredStorage(context.Background(), rdb, negativeTTL, cfg.localSize, localTTL), nil
+	case "memory":
+		ttl, err := time.ParseDuration(cfg.ttl)
+		if err != nil {
+			return cache.Storage{}, err
+		}
+		return cache.NewLRUStorage(cfg.size, ttl, negativeTTL), nil
+	case "none":
+		return cache.NewNopStorage(), nil
+	default:
+		return cache.Storage{}, fmt.Errorf("unknown cache backend %q", cfg.backend)
+	}
+}
+
+func newSafetyChecker(cfg safetyConfig) (safety.Checker, error) {
+	lookupTimeout, err := time.ParseDuration(cfg.lookupTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return safety.New(safety.Config{
+		BlocklistFile: cfg.blocklistFile,
+		DenylistFile:  cfg.denylistFile,
+		LookupURL:     cfg.lookupURL,
+		LookupTimeout: lookupTimeout,
+	})
+}
+
+func newCodeGenerator(cfg codeConfig) (idgen.CodeGenerator, error) {
+	a, err := alphabet.Named(cfg.alphabet)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.strategy {
+	case "sequential":
+		return idgen.NewSequentialCodes(a, cfg.length)
+	case "random":
+		return idgen.NewRandomCodes(a, cfg.length)
+	case "feistel":
+		return idgen.NewFeistelCodes(a, cfg.length, cfg.secret)
+	default:
+		return nil, fmt.Errorf("unknown short code strategy %q", cfg.strategy)
+	}
 }
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/huynguyenanh2000/url-shorterner/internal/ratelimit"
+	"github.com/huynguyenanh2000/url-shorterner/internal/store"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	linkPasswordCookiePrefix = "lp_"
+	maxPasswordFormBytes     = 4096
+)
+
+var (
+	errWrongLinkPassword   = errors.New("wrong password")
+	errTooManyLinkAttempts = errors.New("too many attempts")
+)
+
+var passwordFormTmpl = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Password required</title>
+</head>
+<body>
+<form method="post">
+<p>This link is protected by a password.</p>
+{{if .}}<p role="alert">{{.}}</p>{{end}}
+<input type="password" name="password" aria-label="Password" autofocus required>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+// linkPasswordGate issues and verifies the cookies that unlock
+// password-protected links, and limits failed attempts per link.
+type linkPasswordGate struct {
+	secret    []byte
+	cookieTTL time.Duration
+	secure    bool
+	attempts  ratelimit.Attempts
+}
+
+// newLinkPasswordGate counts failed attempts in Redis when rdb is set, so
+// that they add up across replicas, and in process otherwise or while Redis
+// fails.
+func newLinkPasswordGate(cfg passwordConfig, rdb *redis.Client, logger *zap.SugaredLogger) (*linkPasswordGate, error) {
+	cookieTTL, err := time.ParseDuration(cfg.cookieTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	window, err := time.ParseDuration(cfg.attemptWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	key := []byte(cfg.cookieSecret)
+	if len(key) == 0 {
+		// Cookies then only survive as long as the process, and are not
+		// accepted by other replicas
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+
+	var attempts ratelimit.Attempts = ratelimit.NewMemoryAttempts(cfg.maxAttempts, window)
+	if rdb != nil {
+		attempts = &ratelimit.FallbackAttempts{
+			Primary:   ratelimit.NewRedisAttempts(rdb, "pw:", cfg.maxAttempts, window),
+			Secondary: attempts,
+			OnError: func(err error) {
+				logger.Warnw("redis password attempts failed, counting per process", "error", err)
+			},
+		}
+	}
+
+	return &linkPasswordGate{
+		secret:    key,
+		cookieTTL: cookieTTL,
+		secure:    cfg.secureCookie,
+		attempts:  attempts,
+	}, nil
+}
+
+// sign returns the MAC of an unlock cookie. The password hash is part of
+// the MAC so that changing the password revokes the cookies already issued.
+func (g *linkPasswordGate) sign(url *store.URL, expires int64) string {
+	mac := hmac.New(sha256.New, g.secret)
+	mac.Write([]byte(url.ShortURL + "|" + strconv.FormatInt(expires, 10) + "|" + url.PasswordHash))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (g *linkPasswordGate) cookie(url *store.URL) *http.Cookie {
+	expires := time.Now().Add(g.cookieTTL).Unix()
+
+	return &http.Cookie{
+		Name:     linkPasswordCookiePrefix + url.ShortURL,
+		Value:    strconv.FormatInt(expires, 10) + "." + g.sign(url, expires),
+		Path:     "/",
+		MaxAge:   int(g.cookieTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   g.secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (g *linkPasswordGate) unlocked(r *http.Request, url *store.URL) bool {
+	c, err := r.Cookie(linkPasswordCookiePrefix + url.ShortURL)
+	if err != nil {
+		return false
+	}
+
+	exp, sig, ok := strings.Cut(c.Value, ".")
+	if !ok {
+		return false
+	}
+
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return false
+	}
+
+	return hmac.Equal([]byte(sig), []byte(g.sign(url, expires)))
+}
+
+// linkPasswordMiddleware serves the password form in place of the redirect
+// of a password-protected link, until the client holds an unlock cookie.
+func (app *application) linkPasswordMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := getURLFromCtx(r)
+
+		if !url.HasPassword() || app.linkPasswords.unlocked(r, url) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		app.passwordFormResponse(w, r, http.StatusOK, "")
+	})
+}
+
+// Unlock URL godoc
+//
+//	@Summary		Unlock a password-protected short URL
+//	@Description	Check the password of a short URL submitted from the password form. On success an unlock cookie is set and the client is sent back to the short URL
+//	@Tags			urls
+//	@Accept			x-www-form-urlencoded
+//	@Produce		html
+//	@Param			shortURL	path		string	true	"Short URL"
+//	@Param			password	formData	string	true	"Password of the short URL"
+//	@Success		303			"Unlocked, redirect to the short URL"
+//	@Failure		401			"Wrong password"
+//	@Failure		404			{object}	error	"URL not found"
+//	@Failure		410			{object}	error	"URL has expired"
+//	@Failure		429			"Too many failed attempts"
+//	@Router			/urls/{shortURL} [post]
+func (app *application) urlPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	url := getURLFromCtx(r)
+
+	if !url.HasPassword() {
+		app.notFoundResponse(w, r, store.ErrNotFound)
+		return
+	}
+
+	ctx := r.Context()
+
+	wait, err := app.linkPasswords.attempts.Blocked(ctx, attemptKey(url))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if wait > 0 {
+		app.logger.Warnw("password attempts blocked", "short_url", url.ShortURL, "error", errTooManyLinkAttempts)
+
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		app.passwordFormResponse(w, r, http.StatusTooManyRequests, "Too many attempts, try again later.")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxPasswordFormBytes)
+	if err := r.ParseForm(); err != nil {
+		app.passwordFormResponse(w, r, http.StatusBadRequest, "Invalid form.")
+		return
+	}
+
+	if !url.CheckPassword(r.PostForm.Get("password")) {
+		if err := app.linkPasswords.attempts.Fail(ctx, attemptKey(url)); err != nil {
+			app.logger.Errorw("failed to count link password attempt", "short_url", url.ShortURL, "error", err)
+		}
+		app.logger.Warnw("wrong link password", "short_url", url.ShortURL, "error", errWrongLinkPassword)
+
+		app.passwordFormResponse(w, r, http.StatusUnauthorized, "Wrong password.")
+		return
+	}
+
+	if err := app.linkPasswords.attempts.Reset(ctx, attemptKey(url)); err != nil {
+		app.logger.Errorw("failed to reset link password attempts", "short_url", url.ShortURL, "error", err)
+	}
+	http.SetCookie(w, app.linkPasswords.cookie(url))
+
+	// Send the client back to the short URL, which now redirects. The query
+	// is kept since it may select the domain of the link
+	http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
+}
+
+// attemptKey identifies url among the links of every domain.
+func attemptKey(url *store.URL) string {
+	return url.Domain + "/" + url.ShortURL
+}
+
+func (app *application) passwordFormResponse(w http.ResponseWriter, r *http.Request, status int, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	if err := passwordFormTmpl.Execute(w, message); err != nil {
+		app.logger.Errorw("failed to write password form", "path", r.URL.Path, "error", err)
+	}
+}
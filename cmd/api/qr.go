@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/huynguyenanh2000/url-shorterner/internal/pkg/qrcode"
+)
+
+const (
+	defaultQRSize   = 256
+	minQRSize       = 64
+	maxQRSize       = 2048
+	defaultQRMargin = 4
+	maxQRMargin     = 16
+)
+
+var (
+	errInvalidQRFormat = errors.New("format must be png or svg")
+	errInvalidQRSize   = fmt.Errorf("size must be between %d and %d", minQRSize, maxQRSize)
+	errInvalidQRMargin = fmt.Errorf("margin must be between 0 and %d", maxQRMargin)
+)
+
+type qrOptions struct {
+	format string
+	size   int
+	level  string
+	margin int
+}
+
+func parseQROptions(r *http.Request) (*qrOptions, error) {
+	query := r.URL.Query()
+
+	opts := &qrOptions{
+		format: "png",
+		size:   defaultQRSize,
+		level:  "M",
+		margin: defaultQRMargin,
+	}
+
+	if v := query.Get("format"); v != "" {
+		opts.format = strings.ToLower(v)
+		if opts.format != "png" && opts.format != "svg" {
+			return nil, errInvalidQRFormat
+		}
+	}
+
+	if v := query.Get("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < minQRSize || n > maxQRSize {
+			return nil, errInvalidQRSize
+		}
+		opts.size = n
+	}
+
+	if v := query.Get("level"); v != "" {
+		if _, err := qrcode.ParseLevel(v); err != nil {
+			return nil, err
+		}
+		opts.level = strings.ToUpper(v)
+	}
+
+	if v := query.Get("margin"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxQRMargin {
+			return nil, errInvalidQRMargin
+		}
+		opts.margin = n
+	}
+
+	return opts, nil
+}
+
+// URL QR code godoc
+//
+//	@Summary		Get the QR code of a short URL
+//	@Description	Render a QR code encoding the public short URL, as PNG or SVG
+//	@Tags			urls
+//	@Produce		png
+//	@Produce		image/svg+xml
+//	@Param			shortURL	path	string	true	"Short URL"
+//	@Param			format		query	string	false	"Image format: png or svg (default png)"
+//	@Param			size		query	int		false	"Width and height in pixels, 64 to 2048 (default 256)"
+//	@Param			level		query	string	false	"Error correction level: L, M, Q or H (default M)"
+//	@Param			margin		query	int		false	"Quiet zone in modules, 0 to 16 (default 4)"
+//	@Success		200			"QR code image"
+//	@Success		304			"QR code not modified"
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error	"URL not found"
+//	@Failure		410			{object}	error	"URL has expired"
+//	@Failure		500			{object}	error	"Internal server error"
+//	@Router			/urls/{shortURL}/qr [get]
+func (app *application) urlQRCodeHandler(w http.ResponseWriter, r *http.Request) {
+	url := getURLFromCtx(r)
+
+	opts, err := parseQROptions(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	link := app.shortLink(url.Domain, url.ShortURL)
+
+	// The image only depends on the link and the rendering options, so the
+	// ETag can be computed, and a revalidation answered, without rendering
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s|%s|%d|%s|%d", link, opts.format, opts.size, opts.level, opts.margin))
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, no-cache")
+
+	if match := r.Header.Get("If-None-Match"); match != "" && strings.Contains(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	level, _ := qrcode.ParseLevel(opts.level)
+	code, err := qrcode.Encode(link, level, opts.margin)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	switch opts.format {
+	case "svg":
+		w.Header().Set("Content-Type", "image/svg+xml")
+		err = code.WriteSVG(w, opts.size)
+	default:
+		w.Header().Set("Content-Type", "image/png")
+		err = code.WritePNG(w, opts.size)
+	}
+	if err != nil {
+		app.logger.Errorw("failed to write QR code", "short_url", url.ShortURL, "error", err)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/huynguyenanh2000/url-shorterner/internal/ratelimit"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+var errRateLimited = errors.New("rate limit exceeded")
+
+// rateLimiters holds a limiter per policy, nil when the policy is disabled.
+type rateLimiters struct {
+	auth     ratelimit.Limiter
+	shorten  ratelimit.Limiter
+	redirect ratelimit.Limiter
+}
+
+func newRateLimiters(cfg rateLimitConfig, rdb *redis.Client, logger *zap.SugaredLogger) (rateLimiters, error) {
+	auth, err := newRateLimiter(cfg.backend, "auth", cfg.auth, rdb, logger)
+	if err != nil {
+		return rateLimiters{}, err
+	}
+
+	shorten, err := newRateLimiter(cfg.backend, "shorten", cfg.shorten, rdb, logger)
+	if err != nil {
+		return rateLimiters{}, err
+	}
+
+	redirect, err := newRateLimiter(cfg.backend, "redirect", cfg.redirect, rdb, logger)
+	if err != nil {
+		return rateLimiters{}, err
+	}
+
+	return rateLimiters{auth: auth, shorten: shorten, redirect: redirect}, nil
+}
+
+// newRateLimiter returns the limiter of a policy. The Redis limiter falls
+// back to a per-process one while Redis is failing, so limits still hold on
+// each replica.
+func newRateLimiter(backend, name string, policy rateLimitPolicy, rdb *redis.Client, logger *zap.SugaredLogger) (ratelimit.Limiter, error) {
+	if backend == "none" || policy.requests <= 0 {
+		return nil, nil
+	}
+
+	window, err := time.ParseDuration(policy.window)
+	if err != nil {
+		return nil, err
+	}
+
+	memory := ratelimit.NewMemoryLimiter(policy.requests, window)
+
+	switch backend {
+	case "redis":
+		if rdb == nil {
+			return nil, errors.New("rate limit backend redis requires REDIS_ENABLE=true")
+		}
+		return &ratelimit.Fallback{
+			Primary:   ratelimit.NewRedisLimiter(rdb, fmt.Sprintf("rl:%s:", name), policy.requests, window),
+			Secondary: memory,
+			OnError: func(err error) {
+				logger.Warnw("redis rate limiter failed, limiting per process", "policy", name, "error", err)
+			},
+		}, nil
+	case "memory":
+		return memory, nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", backend)
+	}
+}
+
+// rateLimitMiddleware limits requests per API key, or per client IP for
+// anonymous requests and before authentication.
+func (app *application) rateLimitMiddleware(limiter ratelimit.Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limiter == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if app.allowRequests(w, r, limiter, 1) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// allowRequests counts n requests of the client of r against limiter, for
+// requests worth several, reports the limit in RateLimit-* headers, and
+// answers 429 if they are refused. Requests are let through if the limiter
+// fails.
+func (app *application) allowRequests(w http.ResponseWriter, r *http.Request, limiter ratelimit.Limiter, n int) bool {
+	if limiter == nil {
+		return true
+	}
+
+	res, err := limiter.AllowN(r.Context(), rateLimitKey(r), n)
+	if err != nil {
+		app.logger.Errorw("rate limiter failed", "method", r.Method, "path", r.URL.Path, "error", err)
+		return true
+	}
+
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", res.Limit, ceilSeconds(res.Window)))
+
+	if !res.Allowed {
+		app.rateLimitExceededResponse(w, r, ceilSeconds(res.RetryAfter))
+		return false
+	}
+
+	return true
+}
+
+func rateLimitKey(r *http.Request) string {
+	if apiKey := getAPIKeyFromCtx(r); apiKey != nil {
+		return "key:" + strconv.FormatUint(apiKey.ID, 10)
+	}
+
+	return "ip:" + clientIP(r)
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/huynguyenanh2000/url-shorterner/internal/store"
+)
+
+var errUnsafeDestination = errors.New("long_url is blocked")
+
+var warningPageTmpl = template.Must(template.New("warning").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Warning: unsafe link</title>
+</head>
+<body>
+<h1>This link may be unsafe</h1>
+<p>The page it leads to was flagged: {{.FlaggedReason}}.</p>
+<p>It may try to steal your passwords or personal information, or install harmful software.</p>
+<p><a href="{{.LongURL}}" rel="noreferrer noopener nofollow">Continue to {{.LongURL}} anyway</a></p>
+</body>
+</html>
+`))
+
+// checkDestination runs longURL through the safety checker. It returns an
+// error wrapping errUnsafeDestination if the URL is blocked. When the checker
+// fails, the URL is let through unless safety checks fail closed.
+func (app *application) checkDestination(ctx context.Context, longURL string) error {
+	verdict, err := app.safety.Check(ctx, longURL)
+	if verdict != nil && verdict.Blocked {
+		return fmt.Errorf("%w: %s", errUnsafeDestination, verdict.Reason)
+	}
+
+	if err != nil {
+		if app.config.safety.failClosed {
+			return err
+		}
+		app.logger.Warnw("safety check failed, allowing url", "long_url", longURL, "error", err)
+	}
+
+	return nil
+}
+
+// warningPageResponse serves a warning in place of the redirect of a link
+// whose destination was flagged after it was created.
+func (app *application) warningPageResponse(w http.ResponseWriter, r *http.Request, url *store.URL) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	if err := warningPageTmpl.Execute(w, url); err != nil {
+		app.logger.Errorw("failed to write warning page", "path", r.URL.Path, "error", err)
+	}
+}
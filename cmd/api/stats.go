@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/huynguyenanh2000/url-shorterner/internal/store"
+)
+
+const (
+	defaultStatsDays = 30
+	maxStatsDays     = 365
+)
+
+var errInvalidStatsDays = errors.New("days must be between 1 and 365")
+
+type URLStatsResponse struct {
+	ShortURL string `json:"short_url"`
+	*store.ClickStats
+}
+
+// URL stats godoc
+//
+//	@Summary		Get click stats of a short URL
+//	@Description	Get total clicks plus per-day and per-referrer breakdowns of a short URL
+//	@Tags			urls
+//	@Produce		json
+//	@Param			shortURL	path		string	true	"Short URL"
+//	@Param			days		query		int		false	"Number of days in the per-day breakdown (default 30, max 365)"
+//	@Success		200			{object}	URLStatsResponse
+//	@Failure		400			{object}	error
+//	@Failure		401			{object}	error
+//	@Failure		403			{object}	error	"URL is owned by another API key"
+//	@Failure		404			{object}	error	"URL not found"
+//	@Failure		410			{object}	error	"URL has expired"
+//	@Failure		429			{object}	error	"Rate limit exceeded"
+//	@Failure		500			{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/urls/{shortURL}/stats [get]
+func (app *application) urlStatsHandler(w http.ResponseWriter, r *http.Request) {
+	url := getURLFromCtx(r)
+
+	days := defaultStatsDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxStatsDays {
+			app.badRequestResponse(w, r, errInvalidStatsDays)
+			return
+		}
+		days = n
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	since := today.AddDate(0, 0, -(days - 1))
+
+	stats, err := app.store.Clicks.GetStats(r.Context(), url.ID, since)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	res := URLStatsResponse{
+		ShortURL:   url.ShortURL,
+		ClickStats: stats,
+	}
+
+	if err := jsonResponse(w, http.StatusOK, res); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// clientIP returns the IP of the client, as set on RemoteAddr by the
+// RealIP middleware.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -5,17 +5,43 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/huynguyenanh2000/url-shorterner/internal/analytics"
 	"github.com/huynguyenanh2000/url-shorterner/internal/idgen"
+	"github.com/huynguyenanh2000/url-shorterner/internal/metrics"
+	"github.com/huynguyenanh2000/url-shorterner/internal/pkg/alphabet"
+	"github.com/huynguyenanh2000/url-shorterner/internal/pkg/canonical"
+	"github.com/huynguyenanh2000/url-shorterner/internal/safety"
 	"github.com/huynguyenanh2000/url-shorterner/internal/store"
 	"github.com/huynguyenanh2000/url-shorterner/internal/store/cache"
+	"github.com/stretchr/testify/mock"
 	"go.uber.org/zap"
 )
 
+const testAPIKey = "us_test-api-key"
+
+var testAPIKeyOwner = &store.APIKey{ID: 1, Name: "test"}
+
 func newTestApplication(t *testing.T, cfg config) *application {
 	t.Helper()
 
 	logger := zap.NewNop().Sugar()
 
+	if cfg.redirect.status == 0 {
+		cfg.redirect.status = http.StatusPermanentRedirect
+	}
+	if cfg.redirect.maxAge == 0 {
+		cfg.redirect.maxAge = 86400
+	}
+
+	if cfg.password.cookieTTL == "" {
+		cfg.password = passwordConfig{cookieTTL: "1h", maxAttempts: 3, attemptWindow: "15m"}
+	}
+
+	linkPasswords, err := newLinkPasswordGate(cfg.password, nil, logger)
+	if err != nil {
+		t.Fatalf("failed to initialize link password gate for test: %v", err)
+	}
+
 	mockStore := store.NewMockStore()
 	mockCacheStore := cache.NewMockStore()
 
@@ -24,15 +50,40 @@ func newTestApplication(t *testing.T, cfg config) *application {
 		t.Fatalf("failed to initialize id generator for test: %v", err)
 	}
 
+	codes, err := idgen.NewSequentialCodes(alphabet.Base62, 0)
+	if err != nil {
+		t.Fatalf("failed to initialize short code generator for test: %v", err)
+	}
+
 	return &application{
 		logger:       logger,
 		store:        mockStore,
 		cacheStorage: mockCacheStore,
 		idGenerator:  idGen,
+		codes:        codes,
+		clicks:       analytics.NewMockRecorder(),
 		config:       cfg,
+
+		linkPasswords: linkPasswords,
+		safety:        safety.Multi{},
+		canonical: canonical.New(canonical.Options{
+			SortQuery:      cfg.canonical.sortQuery,
+			StripTracking:  cfg.canonical.stripTracking,
+			TrackingParams: cfg.canonical.trackingParams,
+		}),
+		metrics: metrics.New(nil),
 	}
 }
 
+// authorize sends req with a valid API key, which is expected to be looked
+// up once.
+func authorize(app *application, req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+testAPIKey)
+
+	mockAPIKeyStore := app.store.APIKeys.(*store.MockAPIKeyStore)
+	mockAPIKeyStore.On("GetByHash", mock.Anything, store.HashAPIKey(testAPIKey)).Return(testAPIKeyOwner, nil).Once()
+}
+
 func executeRequest(req *http.Request, mux http.Handler) *httptest.ResponseRecorder {
 	rr := httptest.NewRecorder()
 	mux.ServeHTTP(rr, req)
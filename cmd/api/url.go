@@ -3,19 +3,111 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/huynguyenanh2000/url-shorterner/internal/pkg/base62"
+	"github.com/go-playground/validator/v10"
+	"github.com/huynguyenanh2000/url-shorterner/internal/idgen"
 	"github.com/huynguyenanh2000/url-shorterner/internal/store"
+	"github.com/huynguyenanh2000/url-shorterner/internal/store/cache"
 )
 
 type urlKey string
 
 const urlCtx urlKey = "url"
 
+var (
+	errAliasTaken    = errors.New("alias is already in use")
+	errAliasLikeCode = errors.New("alias must not look like a generated short url")
+	errExpiryInPast  = errors.New("expires_at must be in the future")
+	errURLHasExpired = errors.New("url has expired")
+	errInvalidCursor = errors.New("cursor must be a url id")
+	errInvalidLimit  = errors.New("limit must be between 1 and 100")
+
+	errInvalidShortURL = errors.New("short url is neither a code nor an alias")
+)
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+var aliasRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Length bounds of vanity aliases, as validated on ShorternURLPayload.Alias.
+const (
+	minAliasLength = 3
+	maxAliasLength = idgen.MaxCodeLength
+)
+
+// reservedAliases are path segments served by the API itself, which a vanity
+// alias must not shadow.
+var reservedAliases = map[string]struct{}{
+	"v1":      {},
+	"api":     {},
+	"health":  {},
+	"swagger": {},
+	"docs":    {},
+	"urls":    {},
+	"metrics": {},
+}
+
 type ShorternURLPayload struct {
-	LongURL string `json:"long_url" validate:"required,http_url"`
+	LongURL    string     `json:"long_url" validate:"required,http_url"`
+	Alias      string     `json:"alias,omitempty" validate:"omitempty,alias"`
+	TTLSeconds int64      `json:"ttl_seconds,omitempty" validate:"omitempty,gt=0,max=315360000"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" validate:"omitempty,excluded_with=TTLSeconds"`
+	// HTTP status used to redirect, defaults to the service-wide one
+	RedirectType int `json:"redirect_type,omitempty" validate:"omitempty,oneof=301 302 307 308"`
+	// Password visitors must enter before being redirected, at most 72 bytes
+	Password string `json:"password,omitempty" validate:"omitempty,min=4,max=72,password"`
+	// Number of redirects allowed before the link is gone, 1 for a one-time link
+	MaxClicks int `json:"max_clicks,omitempty" validate:"omitempty,gt=0,max=4294967295"`
+	// Branded domain serving the link, defaults to the domain of the API
+	Domain string `json:"domain,omitempty" validate:"omitempty,hostname_rfc1123"`
+}
+
+// expiry returns the absolute expiry requested by the payload, if any.
+func (p *ShorternURLPayload) expiry(now time.Time) (*time.Time, error) {
+	switch {
+	case p.TTLSeconds > 0:
+		expiresAt := now.Add(time.Duration(p.TTLSeconds) * time.Second).UTC()
+		return &expiresAt, nil
+	case p.ExpiresAt != nil:
+		if !p.ExpiresAt.After(now) {
+			return nil, errExpiryInPast
+		}
+		expiresAt := p.ExpiresAt.UTC()
+		return &expiresAt, nil
+	}
+
+	return nil, nil
+}
+
+// validateAlias checks the length and characters of an alias, and that it is
+// not reserved.
+func validateAlias(fl validator.FieldLevel) bool {
+	alias := fl.Field().String()
+	if !isAliasShaped(alias) {
+		return false
+	}
+
+	_, reserved := reservedAliases[strings.ToLower(alias)]
+	return !reserved
+}
+
+// maxLinkPasswordBytes is the longest password bcrypt hashes.
+const maxLinkPasswordBytes = 72
+
+// validatePassword checks the length of a link password in bytes, as max
+// counts characters.
+func validatePassword(fl validator.FieldLevel) bool {
+	return len(fl.Field().String()) <= maxLinkPasswordBytes
 }
 
 // Shortern URL godoc
@@ -26,9 +118,13 @@ type ShorternURLPayload struct {
 //	@Accept			json
 //	@Produce		json
 //	@Param			payload	body		ShorternURLPayload	true	"URL payload"
-//	@Success		201		{object}	store.URL
-//	@Failure		400		{object}	error
+//	@Success		201		{object}	URLResponse
+//	@Header			201		{string}	Location	"Short link of the new URL"
+//	@Failure		400		{object}	error		"Invalid payload or unknown domain"
 //	@Failure		401		{object}	error
+//	@Failure		409		{object}	error	"Alias already in use"
+//	@Failure		422		{object}	error	"Long URL is blocked by safety checks, points at another shortener or at a short link that cannot be followed"
+//	@Failure		429		{object}	error	"Rate limit exceeded"
 //	@Failure		500		{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/urls/shorten [post]
@@ -44,58 +140,226 @@ func (app *application) urlShortenHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	ctx := r.Context()
+	// Aliases and generated codes must be told apart on redirect
+	if payload.Alias != "" && app.codes.Shaped(payload.Alias) {
+		app.badRequestResponse(w, r, errAliasLikeCode)
+		return
+	}
 
-	longURLHash := store.ComputeHash(payload.LongURL)
+	expiresAt, err := payload.expiry(time.Now())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
 
-	// Check cache
-	existingURL, err := app.cacheStorage.URL.GetByLongURLHash(ctx, longURLHash)
+	domain, err := app.payloadDomain(payload.Domain)
 	if err != nil {
-		app.internalServerError(w, r, err)
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	// If longURLHash exists => return 200 OK
-	if existingURL != nil {
-		if err := jsonResponse(w, http.StatusOK, existingURL); err != nil {
+	longURL, err := app.validateDestination(r.Context(), payload.LongURL)
+	if err != nil {
+		app.destinationErrorResponse(w, r, err)
+		return
+	}
+
+	url := &store.URL{
+		OwnerID:      getAPIKeyFromCtx(r).ID,
+		Domain:       domain,
+		LongURL:      longURL,
+		ShortURL:     payload.Alias,
+		IsCustom:     payload.Alias != "",
+		ExpiresAt:    expiresAt,
+		RedirectType: payload.RedirectType,
+	}
+
+	if payload.MaxClicks > 0 {
+		url.MaxClicks = &payload.MaxClicks
+	}
+
+	if payload.Password != "" {
+		if err := url.SetPassword(payload.Password); err != nil {
 			app.internalServerError(w, r, err)
 			return
 		}
+	}
+
+	// Vanity aliases and links with their own settings always get their own row
+	if !url.Dedupable() {
+		app.createURL(w, r, url)
 		return
 	}
 
-	// Cache miss -> Check database
-	existingURL, err = app.store.URL.GetByLongURL(ctx, payload.LongURL)
-	if err != nil && err != store.ErrNotFound {
+	ctx := r.Context()
+	longURLHash := store.ComputeHash(url.LongURL)
+
+	// Concurrent requests for the same long URL in this process share a
+	// single lookup-or-create, which must not be canceled by the leader alone
+	var leader bool
+	v, err, _ := app.inflight.Do(fmt.Sprintf("%d:%s:%s", url.OwnerID, url.Domain, longURLHash), func() (any, error) {
+		leader = true
+		return app.findOrCreateURL(context.WithoutCancel(ctx), url)
+	})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// If the long URL was already shortened => return 200 OK
+	res := v.(*shortenResult)
+	status := http.StatusOK
+	if res.created && leader {
+		status = http.StatusCreated
+	}
+
+	body := app.urlResponse(res.url)
+	if status == http.StatusCreated {
+		w.Header().Set("Location", body.Link)
+	}
+
+	if err := jsonResponse(w, status, body); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
+}
 
+type shortenResult struct {
+	url     *store.URL
+	created bool
+}
+
+// findOrCreateURL returns the URL the owner already has for url.LongURL on
+// url.Domain, or creates url. Requests racing on the same long URL, in this or another
+// replica, all end up with the same row.
+func (app *application) findOrCreateURL(ctx context.Context, url *store.URL) (*shortenResult, error) {
+	existingURL, err := app.findExistingURL(ctx, url.OwnerID, url.Domain, url.LongURL)
+	if err != nil {
+		return nil, err
+	}
 	if existingURL != nil {
-		_ = app.cacheStorage.URL.Set(ctx, existingURL)
+		return &shortenResult{url: existingURL}, nil
+	}
 
-		if err := jsonResponse(w, http.StatusOK, existingURL); err != nil {
-			app.internalServerError(w, r, err)
-			return
+	// Serialize creation across replicas. The unique index still keeps a
+	// single row without the lock, so carry on if it is not acquired in time
+	unlock, err := app.cacheStorage.URL.LockLongURL(ctx, url.OwnerID, url.Domain, store.ComputeHash(url.LongURL))
+	switch {
+	case err == nil:
+		defer unlock()
+
+		// Another replica may have created it while we were waiting
+		existingURL, err := app.findExistingURL(ctx, url.OwnerID, url.Domain, url.LongURL)
+		if err != nil {
+			return nil, err
 		}
-		return
+		if existingURL != nil {
+			return &shortenResult{url: existingURL}, nil
+		}
+	case !errors.Is(err, cache.ErrLockNotAcquired):
+		return nil, err
+	}
+
+	app.assignShortURL(url)
+
+	// Save to DB
+	err = app.insertURL(ctx, url)
+	if errors.Is(err, store.ErrDuplicateLongURL) {
+		// Lost the race, return the winner's row
+		winner, err := app.store.URL.GetByLongURL(ctx, url.OwnerID, url.Domain, url.LongURL)
+		if err != nil {
+			return nil, err
+		}
+		return &shortenResult{url: winner}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Save to cache
+	if err := app.cacheStorage.URL.Set(ctx, url); err != nil {
+		return nil, err
+	}
+
+	return &shortenResult{url: url, created: true}, nil
+}
+
+// findExistingURL returns the dedupable URL an owner already has for longURL
+// on domain, checking the cache first and then the database. It returns nil
+// if there is none.
+func (app *application) findExistingURL(ctx context.Context, ownerID uint64, domain, longURL string) (*store.URL, error) {
+	longURLHash := store.ComputeHash(longURL)
+
+	// Check cache
+	existingURL, err := app.cacheStorage.URL.GetByLongURLHash(ctx, ownerID, domain, longURLHash)
+	if err != nil {
+		return nil, err
+	}
+
+	app.metrics.CacheLookup("GetByLongURLHash", existingURL != nil)
+	if existingURL != nil {
+		return existingURL, nil
 	}
 
+	// Cache miss -> Check database
+	existingURL, err = app.store.URL.GetByLongURL(ctx, ownerID, domain, longURL)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	_ = app.cacheStorage.URL.Set(ctx, existingURL)
+
+	return existingURL, nil
+}
+
+// maxCodeAttempts bounds the short codes drawn for a new link while they
+// collide with existing ones.
+const maxCodeAttempts = 5
+
+// assignShortURL gives url a new ID, keeping url.ShortURL for vanity aliases
+// and drawing a code from the configured strategy otherwise.
+func (app *application) assignShortURL(url *store.URL) {
 	// Generate ID
-	id := app.idGenerator.Generate()
+	url.ID = app.idGenerator.Generate()
 
-	// Encode to Base62
-	shortURL := base62.Encode(id)
+	if !url.IsCustom {
+		url.ShortURL = app.codes.Code(url.ID)
+	}
+}
 
-	url := &store.URL{
-		ID:       id,
-		LongURL:  payload.LongURL,
-		ShortURL: shortURL,
+// insertURL saves url to the database, drawing a new short code while the
+// generated one is taken, e.g. by a random code or a vanity alias.
+func (app *application) insertURL(ctx context.Context, url *store.URL) error {
+	for attempt := 1; ; attempt++ {
+		app.addKnownLinks(url)
+
+		err := app.store.URL.Create(ctx, url)
+		if !errors.Is(err, store.ErrConflict) || url.IsCustom || attempt == maxCodeAttempts {
+			return err
+		}
+
+		app.logger.Warnw("short code taken, drawing another", "short_url", url.ShortURL, "attempt", attempt)
+		app.assignShortURL(url)
 	}
+}
+
+// createURL stores url under a newly assigned short URL.
+func (app *application) createURL(w http.ResponseWriter, r *http.Request, url *store.URL) {
+	ctx := r.Context()
+
+	app.assignShortURL(url)
 
 	// Save to DB
-	if err := app.store.URL.Create(ctx, url); err != nil {
-		app.internalServerError(w, r, err)
+	if err := app.insertURL(ctx, url); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict) && url.IsCustom:
+			app.conflictResponse(w, r, errAliasTaken)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
@@ -105,12 +369,218 @@ func (app *application) urlShortenHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if err := jsonResponse(w, http.StatusCreated, url); err != nil {
+	body := app.urlResponse(url)
+	w.Header().Set("Location", body.Link)
+
+	if err := jsonResponse(w, http.StatusCreated, body); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type UpdateURLPayload struct {
+	LongURL string `json:"long_url" validate:"required,http_url"`
+}
+
+type ListURLsResponse struct {
+	URLs []*URLResponse `json:"urls"`
+	// Cursor of the next page, empty on the last page
+	NextCursor string `json:"next_cursor"`
+}
+
+// List URLs godoc
+//
+//	@Summary		List URLs
+//	@Description	List the URLs owned by the caller, newest first
+//	@Tags			urls
+//	@Produce		json
+//	@Param			cursor	query		string	false	"next_cursor of the previous page"
+//	@Param			limit	query		int		false	"Page size (default 20, max 100)"
+//	@Success		200		{object}	ListURLsResponse
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		429		{object}	error	"Rate limit exceeded"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/urls [get]
+func (app *application) listURLsHandler(w http.ResponseWriter, r *http.Request) {
+	var cursor uint64
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		c, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, errInvalidCursor)
+			return
+		}
+		cursor = c
+	}
+
+	limit := defaultListLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 || l > maxListLimit {
+			app.badRequestResponse(w, r, errInvalidLimit)
+			return
+		}
+		limit = l
+	}
+
+	// Fetch one extra row to know whether there is a next page
+	urls, err := app.store.URL.List(r.Context(), getAPIKeyFromCtx(r).ID, cursor, limit+1)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var nextCursor string
+	if len(urls) > limit {
+		urls = urls[:limit]
+		nextCursor = strconv.FormatUint(urls[limit-1].ID, 10)
+	}
+
+	res := ListURLsResponse{URLs: make([]*URLResponse, len(urls)), NextCursor: nextCursor}
+	for i, url := range urls {
+		res.URLs[i] = app.urlResponse(url)
+	}
+
+	if err := jsonResponse(w, http.StatusOK, res); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// Get URL info godoc
+//
+//	@Summary		Get URL metadata
+//	@Description	Get the metadata of a short URL as JSON instead of redirecting
+//	@Tags			urls
+//	@Produce		json
+//	@Param			shortURL	path		string	true	"Short URL"
+//	@Success		200			{object}	URLResponse
+//	@Failure		401			{object}	error
+//	@Failure		403			{object}	error	"URL is owned by another API key"
+//	@Failure		404			{object}	error	"URL not found"
+//	@Failure		410			{object}	error	"URL has expired"
+//	@Failure		429			{object}	error	"Rate limit exceeded"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/urls/{shortURL}/info [get]
+func (app *application) urlInfoHandler(w http.ResponseWriter, r *http.Request) {
+	url := getURLFromCtx(r)
+
+	if err := jsonResponse(w, http.StatusOK, app.urlResponse(url)); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 }
 
+// Update URL godoc
+//
+//	@Summary		Update URL target
+//	@Description	Change the long URL a short URL redirects to
+//	@Tags			urls
+//	@Accept			json
+//	@Produce		json
+//	@Param			shortURL	path		string				true	"Short URL"
+//	@Param			payload		body		UpdateURLPayload	true	"URL payload"
+//	@Success		200			{object}	URLResponse
+//	@Failure		400			{object}	error
+//	@Failure		401			{object}	error
+//	@Failure		403			{object}	error	"URL is owned by another API key"
+//	@Failure		404			{object}	error	"URL not found"
+//	@Failure		409			{object}	error	"Another URL already points to the long URL"
+//	@Failure		410			{object}	error	"URL has expired"
+//	@Failure		422			{object}	error	"Long URL is blocked by safety checks, points at another shortener or at a short link that cannot be followed"
+//	@Failure		429			{object}	error	"Rate limit exceeded"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/urls/{shortURL} [patch]
+func (app *application) updateURLHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateURLPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	oldURL := getURLFromCtx(r)
+
+	longURL, err := app.validateDestination(ctx, payload.LongURL)
+	if err != nil {
+		app.destinationErrorResponse(w, r, err)
+		return
+	}
+
+	// A flag was about the previous destination only
+	url := *oldURL
+	url.LongURL = longURL
+	url.FlaggedReason = ""
+
+	if err := app.store.URL.Update(ctx, &url); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicateLongURL):
+			app.conflictResponse(w, r, err)
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// Drop both the short and the old long URL keys
+	if err := app.cacheStorage.URL.Delete(ctx, oldURL); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := jsonResponse(w, http.StatusOK, app.urlResponse(&url)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// Delete URL godoc
+//
+//	@Summary		Delete URL
+//	@Description	Delete a short URL
+//	@Tags			urls
+//	@Param			shortURL	path	string	true	"Short URL"
+//	@Success		204
+//	@Failure		401	{object}	error
+//	@Failure		403	{object}	error	"URL is owned by another API key"
+//	@Failure		404	{object}	error	"URL not found"
+//	@Failure		410	{object}	error	"URL has expired"
+//	@Failure		429	{object}	error	"Rate limit exceeded"
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/urls/{shortURL} [delete]
+func (app *application) deleteURLHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	url := getURLFromCtx(r)
+
+	if err := app.store.URL.Delete(ctx, url.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.cacheStorage.URL.Delete(ctx, url); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // Redirect URL godoc
 //
 //	@Summary		Redirect to long URL
@@ -121,8 +591,14 @@ func (app *application) urlShortenHandler(w http.ResponseWriter, r *http.Request
 //	@Produce		json
 //
 //	@Param			shortURL	path		string	true	"Short URL"
+//	@Success		301			{string}	string	"Moved Permanently"
+//	@Success		302			{string}	string	"Found"
+//	@Success		307			{string}	string	"Temporary Redirect"
 //	@Success		308			{string}	string	"Permanent Redirect"
+//	@Success		200			{string}	string	"Password form of a password-protected URL, or warning page of a flagged URL"
 //	@Failure		404			{object}	error	"URL not found"
+//	@Failure		410			{object}	error	"URL has expired or has no clicks left"
+//	@Failure		429			{object}	error	"Rate limit exceeded"
 //	@Failure		500			{object}	error	"Internal server error"
 //
 // Security ApiKeyAuth
@@ -131,36 +607,161 @@ func (app *application) urlShortenHandler(w http.ResponseWriter, r *http.Request
 func (app *application) urlRedirectHandler(w http.ResponseWriter, r *http.Request) {
 	url := getURLFromCtx(r)
 
-	http.Redirect(w, r, url.LongURL, http.StatusPermanentRedirect)
+	if url.IsFlagged() {
+		app.warningPageResponse(w, r, url)
+		return
+	}
+
+	if url.MaxClicks != nil {
+		if err := app.consumeClick(r.Context(), url); err != nil {
+			switch {
+			case errors.Is(err, store.ErrClicksExhausted):
+				app.goneResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+	}
+
+	app.clicks.Record(&store.Click{
+		URLID:     url.ID,
+		ShortURL:  url.ShortURL,
+		Referrer:  r.Referer(),
+		UserAgent: r.UserAgent(),
+		IP:        clientIP(r),
+		ClickedAt: time.Now().UTC(),
+	})
+
+	status := url.RedirectType
+	if status == 0 {
+		status = app.config.redirect.status
+	}
+
+	w.Header().Set("Cache-Control", app.redirectCacheControl(url, status))
+	http.Redirect(w, r, url.LongURL, status)
 }
 
+// consumeClick counts a click against the click limit of url. It returns
+// store.ErrClicksExhausted once the limit is reached.
+//
+// The database holds the authoritative count. The clicks left cached in
+// Redis only turn away clicks of used up links without a write to the
+// database. They may overstate what the database allows, never understate
+// it: the counter is reset whenever it could.
+func (app *application) consumeClick(ctx context.Context, url *store.URL) error {
+	left, cached, err := app.cacheStorage.URL.DecrClicks(ctx, url.Domain, url.ShortURL)
+	if err != nil {
+		app.logger.Warnw("failed to decrement cached clicks", "short_url", url.ShortURL, "error", err)
+		cached = false
+	}
+
+	if cached && left < 0 {
+		return store.ErrClicksExhausted
+	}
+
+	count, err := app.store.URL.ConsumeClick(ctx, url.ID)
+	if errors.Is(err, store.ErrClicksExhausted) {
+		app.setCachedClicks(ctx, url, 0)
+		return err
+	} else if err != nil {
+		// The click may not have been counted, drop the counter that was
+		// already decremented for it
+		if cached {
+			if err := app.cacheStorage.URL.DeleteClicks(ctx, url.Domain, url.ShortURL); err != nil {
+				app.logger.Warnw("failed to delete cached clicks", "short_url", url.ShortURL, "error", err)
+			}
+		}
+		return err
+	}
+
+	if !cached {
+		app.setCachedClicks(ctx, url, int64(*url.MaxClicks-count))
+	}
+
+	return nil
+}
+
+func (app *application) setCachedClicks(ctx context.Context, url *store.URL, left int64) {
+	if err := app.cacheStorage.URL.SetClicks(ctx, url, left); err != nil {
+		app.logger.Warnw("failed to cache clicks", "short_url", url.ShortURL, "error", err)
+	}
+}
+
+// redirectCacheControl lets browsers cache permanent redirects for a bounded
+// time, never past the expiry of the link. Temporary redirects, links behind
+// a password or a click limit are never cached, so that every click reaches
+// the service.
+func (app *application) redirectCacheControl(url *store.URL, status int) string {
+	if url.HasPassword() || url.MaxClicks != nil {
+		return "no-store"
+	}
+
+	switch status {
+	case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+		maxAge := app.config.redirect.maxAge
+		if url.ExpiresAt != nil {
+			maxAge = min(maxAge, int(time.Until(*url.ExpiresAt).Seconds()))
+		}
+
+		if maxAge > 0 {
+			return fmt.Sprintf("public, max-age=%d", maxAge)
+		}
+	}
+
+	return "no-store"
+}
+
+func isRedirectStatus(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+
+	return false
+}
+
+// shortURLMiddleware turns away short URLs no link can have, which scanners
+// probe, before any I/O. It runs ahead of rate limiting and the lookup.
+func (app *application) shortURLMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.validShortURL(chi.URLParam(r, "shortURL")) {
+			app.notFoundResponse(w, r, errInvalidShortURL)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// urlContextMiddleware puts the link at the short URL in context. It must run
+// after shortURLMiddleware.
 func (app *application) urlContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		shortURL := chi.URLParam(r, "shortURL")
 		ctx := r.Context()
 
-		url, err := app.cacheStorage.URL.GetByShortURL(ctx, shortURL)
-		if err != nil {
-			app.internalServerError(w, r, err)
+		domain, ok := app.requestDomain(r)
+		if !ok {
+			app.notFoundResponse(w, r, errUnknownDomain)
 			return
 		}
 
-		if url == nil {
-			url, err = app.store.URL.GetByShortURL(ctx, shortURL)
-			if err != nil {
-				switch {
-				case errors.Is(err, store.ErrNotFound):
-					app.notFoundResponse(w, r, err)
-				default:
-					app.internalServerError(w, r, err)
-				}
-				return
-			}
-
-			if err := app.cacheStorage.URL.Set(ctx, url); err != nil {
+		url, err := app.getURL(ctx, domain, shortURL)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
 				app.internalServerError(w, r, err)
-				return
 			}
+			return
+		}
+
+		// Expired links are gone on every route, not only for redirects
+		if url.IsExpired() {
+			app.goneResponse(w, r, errURLHasExpired)
+			return
 		}
 
 		ctx = context.WithValue(ctx, urlCtx, url)
@@ -168,6 +769,83 @@ func (app *application) urlContextMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// getURL looks a short URL on domain up in the filter of known links, the
+// cache, then in the database, caching what it finds there, including that
+// nothing was found.
+func (app *application) getURL(ctx context.Context, domain, shortURL string) (*store.URL, error) {
+	if app.unknownLink(domain, shortURL) {
+		return nil, store.ErrNotFound
+	}
+
+	url, err := app.cacheStorage.URL.GetByShortURL(ctx, domain, shortURL)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	// A short URL known missing is a hit too, the database is spared
+	app.metrics.CacheLookup("GetByShortURL", url != nil || err != nil)
+	if url != nil || err != nil {
+		return url, err
+	}
+
+	url, err = app.lookupURL(ctx, domain, shortURL)
+	if errors.Is(err, store.ErrNotFound) {
+		_ = app.cacheStorage.URL.SetMissing(ctx, domain, shortURL)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := app.cacheStorage.URL.Set(ctx, url); err != nil {
+		return nil, err
+	}
+
+	return url, nil
+}
+
+// lookupURL looks a short URL on domain up in the database, by primary key
+// when it decodes to an ID. Codes of another strategy, such as one configured
+// before, may decode to the ID of no link or of another one, so those are
+// looked up by short URL after all.
+func (app *application) lookupURL(ctx context.Context, domain, shortURL string) (*store.URL, error) {
+	id, ok := app.codes.Decode(shortURL)
+	if !ok {
+		return app.store.URL.GetByShortURL(ctx, domain, shortURL)
+	}
+
+	url, err := app.store.URL.GetByID(ctx, id)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	if url == nil || url.ShortURL != shortURL {
+		return app.store.URL.GetByShortURL(ctx, domain, shortURL)
+	}
+
+	if url.Domain != domain {
+		return nil, store.ErrNotFound
+	}
+
+	return url, nil
+}
+
+// validShortURL reports whether a link may be served at shortURL, which is
+// either shaped like a vanity alias or a code some strategy may have
+// generated. Strings shaped like codes of the configured strategy are never
+// aliases, so those no strategy can generate are rejected.
+func (app *application) validShortURL(shortURL string) bool {
+	if app.codes.Shaped(shortURL) {
+		return app.codes.Possible(shortURL)
+	}
+
+	return isAliasShaped(shortURL)
+}
+
+func isAliasShaped(shortURL string) bool {
+	return len(shortURL) >= minAliasLength && len(shortURL) <= maxAliasLength && aliasRegex.MatchString(shortURL)
+}
+
 func getURLFromCtx(r *http.Request) *store.URL {
 	url, _ := r.Context().Value(urlCtx).(*store.URL)
 	return url
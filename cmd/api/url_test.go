@@ -2,10 +2,21 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"image/png"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/huynguyenanh2000/url-shorterner/internal/analytics"
+	"github.com/huynguyenanh2000/url-shorterner/internal/idgen"
+	"github.com/huynguyenanh2000/url-shorterner/internal/pkg/alphabet"
+	"github.com/huynguyenanh2000/url-shorterner/internal/pkg/bloom"
+	"github.com/huynguyenanh2000/url-shorterner/internal/ratelimit"
+	"github.com/huynguyenanh2000/url-shorterner/internal/safety"
 	"github.com/huynguyenanh2000/url-shorterner/internal/store"
 	"github.com/huynguyenanh2000/url-shorterner/internal/store/cache"
 	"github.com/stretchr/testify/mock"
@@ -16,10 +27,22 @@ func resetMocks(app *application) {
 		mockStore.ExpectedCalls = nil
 		mockStore.Calls = nil
 	}
+	if mockAPIKeyStore, ok := app.store.APIKeys.(*store.MockAPIKeyStore); ok {
+		mockAPIKeyStore.ExpectedCalls = nil
+		mockAPIKeyStore.Calls = nil
+	}
+	if mockClickStore, ok := app.store.Clicks.(*store.MockClickStore); ok {
+		mockClickStore.ExpectedCalls = nil
+		mockClickStore.Calls = nil
+	}
 	if mockCache, ok := app.cacheStorage.URL.(*cache.MockURLStore); ok {
 		mockCache.ExpectedCalls = nil
 		mockCache.Calls = nil
 	}
+	if mockRecorder, ok := app.clicks.(*analytics.MockRecorder); ok {
+		mockRecorder.ExpectedCalls = nil
+		mockRecorder.Calls = nil
+	}
 }
 
 func TestShorternURL(t *testing.T) {
@@ -31,7 +54,7 @@ func TestShorternURL(t *testing.T) {
 	app := newTestApplication(t, withRedis)
 	mux := app.mount()
 
-	longURL := "https://google.com"
+	longURL := "https://google.com/"
 	longURLHash := store.ComputeHash(longURL)
 	payload := ShorternURLPayload{LongURL: longURL}
 	body, _ := json.Marshal(payload)
@@ -46,15 +69,83 @@ func TestShorternURL(t *testing.T) {
 			ShortURL: "abcxyz",
 		}
 
-		mockCacheStore.On("GetByLongURLHash", mock.Anything, longURLHash).Return(existingURL, nil)
+		mockCacheStore.On("GetByLongURLHash", mock.Anything, testAPIKeyOwner.ID, "", longURLHash).Return(existingURL, nil)
+
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+		mockCacheStore.AssertExpectations(t)
+	})
+
+	t.Run("should return 200 for another spelling of an existing URL", func(t *testing.T) {
+		resetMocks(app)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		existingURL := &store.URL{
+			ID:       12345,
+			LongURL:  longURL,
+			ShortURL: "abcxyz",
+		}
+
+		mockCacheStore.On("GetByLongURLHash", mock.Anything, testAPIKeyOwner.ID, "", longURLHash).Return(existingURL, nil).Once()
+
+		body, _ := json.Marshal(ShorternURLPayload{LongURL: "HTTPS://Google.com:443"})
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+		mockCacheStore.AssertExpectations(t)
+	})
+
+	t.Run("should keep tracking params by default", func(t *testing.T) {
+		resetMocks(app)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		tracked := longURL + "?utm_source=newsletter"
+		existingURL := &store.URL{
+			ID:       12346,
+			LongURL:  tracked,
+			ShortURL: "abcxyw",
+		}
+
+		mockCacheStore.On("GetByLongURLHash", mock.Anything, testAPIKeyOwner.ID, "", store.ComputeHash(tracked)).Return(existingURL, nil).Once()
 
+		body, _ := json.Marshal(ShorternURLPayload{LongURL: tracked})
 		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(app, req)
 		rr := executeRequest(req, mux)
 
 		checkResponseCode(t, http.StatusOK, rr.Code)
 		mockCacheStore.AssertExpectations(t)
 	})
 
+	t.Run("should strip tracking params if configured", func(t *testing.T) {
+		stripping := newTestApplication(t, config{
+			redisCfg:  redisConfig{enable: true},
+			canonical: canonicalConfig{stripTracking: true},
+		})
+		mockCacheStore := stripping.cacheStorage.URL.(*cache.MockURLStore)
+
+		existingURL := &store.URL{
+			ID:       12345,
+			LongURL:  longURL,
+			ShortURL: "abcxyz",
+		}
+
+		mockCacheStore.On("GetByLongURLHash", mock.Anything, testAPIKeyOwner.ID, "", longURLHash).Return(existingURL, nil).Once()
+
+		body, _ := json.Marshal(ShorternURLPayload{LongURL: "HTTPS://Google.com:443?utm_source=newsletter&fbclid=abc"})
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(stripping, req)
+		rr := executeRequest(req, stripping.mount())
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+		mockCacheStore.AssertExpectations(t)
+	})
+
 	t.Run("should return 200 and set cache if cache miss but DB exists", func(t *testing.T) {
 		resetMocks(app)
 		mockStore := app.store.URL.(*store.MockURLStore)
@@ -67,11 +158,12 @@ func TestShorternURL(t *testing.T) {
 		}
 
 		// Logic: Cache Miss -> DB Hit -> Set Cache
-		mockCacheStore.On("GetByLongURLHash", mock.Anything, longURLHash).Return(nil, nil).Once()
-		mockStore.On("GetByLongURL", mock.Anything, longURL).Return(existingURL, nil).Once()
+		mockCacheStore.On("GetByLongURLHash", mock.Anything, testAPIKeyOwner.ID, "", longURLHash).Return(nil, nil).Once()
+		mockStore.On("GetByLongURL", mock.Anything, testAPIKeyOwner.ID, "", longURL).Return(existingURL, nil).Once()
 		mockCacheStore.On("Set", mock.Anything, existingURL).Return(nil).Once()
 
 		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(app, req)
 		rr := executeRequest(req, mux)
 
 		checkResponseCode(t, http.StatusOK, rr.Code)
@@ -85,18 +177,20 @@ func TestShorternURL(t *testing.T) {
 		mockStore := app.store.URL.(*store.MockURLStore)
 		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
 
-		// Logic: Cache Miss -> DB Miss -> Create -> Set Cache
-		mockCacheStore.On("GetByLongURLHash", mock.Anything, longURLHash).Return(nil, nil)
-		mockStore.On("GetByLongURL", mock.Anything, longURL).Return(nil, store.ErrNotFound)
+		// Logic: Cache Miss -> DB Miss -> Lock -> Cache Miss -> DB Miss -> Create -> Set Cache
+		mockCacheStore.On("GetByLongURLHash", mock.Anything, testAPIKeyOwner.ID, "", longURLHash).Return(nil, nil)
+		mockStore.On("GetByLongURL", mock.Anything, testAPIKeyOwner.ID, "", longURL).Return(nil, store.ErrNotFound)
+		mockCacheStore.On("LockLongURL", mock.Anything, testAPIKeyOwner.ID, "", longURLHash).Return(func() {}, nil).Once()
 
 		mockStore.On("Create", mock.Anything, mock.MatchedBy(func(u *store.URL) bool {
-			return u.LongURL == longURL
+			return u.LongURL == longURL && u.OwnerID == testAPIKeyOwner.ID
 		})).Return(nil).Once()
 		mockCacheStore.On("Set", mock.Anything, mock.MatchedBy(func(u *store.URL) bool {
 			return u.LongURL == longURL
 		})).Return(nil).Once()
 
 		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(app, req)
 		rr := executeRequest(req, mux)
 
 		checkResponseCode(t, http.StatusCreated, rr.Code)
@@ -105,6 +199,68 @@ func TestShorternURL(t *testing.T) {
 		mockStore.AssertExpectations(t)
 	})
 
+	t.Run("should return 200 with the winner's row if a concurrent request created it first", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		winnerURL := &store.URL{
+			ID:       12345,
+			OwnerID:  testAPIKeyOwner.ID,
+			LongURL:  longURL,
+			ShortURL: "winner",
+		}
+
+		// Logic: Lock not acquired in time -> Create loses on the unique index -> Read winner
+		mockCacheStore.On("GetByLongURLHash", mock.Anything, testAPIKeyOwner.ID, "", longURLHash).Return(nil, nil).Once()
+		mockStore.On("GetByLongURL", mock.Anything, testAPIKeyOwner.ID, "", longURL).Return(nil, store.ErrNotFound).Once()
+		mockCacheStore.On("LockLongURL", mock.Anything, testAPIKeyOwner.ID, "", longURLHash).Return(nil, cache.ErrLockNotAcquired).Once()
+		mockStore.On("Create", mock.Anything, mock.Anything).Return(store.ErrDuplicateLongURL).Once()
+		mockStore.On("GetByLongURL", mock.Anything, testAPIKeyOwner.ID, "", longURL).Return(winnerURL, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var res struct {
+			Data store.URL `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Data.ShortURL != winnerURL.ShortURL {
+			t.Errorf("expected winner short url %s, got %s", winnerURL.ShortURL, res.Data.ShortURL)
+		}
+
+		mockCacheStore.AssertNotCalled(t, "Set", mock.Anything, mock.Anything)
+		mockCacheStore.AssertExpectations(t)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("should return 401 if API key is missing or unknown", func(t *testing.T) {
+		resetMocks(app)
+		mockAPIKeyStore := app.store.APIKeys.(*store.MockAPIKeyStore)
+		mockStore := app.store.URL.(*store.MockURLStore)
+
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+
+		mockAPIKeyStore.On("GetByHash", mock.Anything, store.HashAPIKey("unknown")).Return(nil, store.ErrNotFound).Once()
+
+		req, _ = http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		req.Header.Set("Authorization", "Bearer unknown")
+		rr = executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+
+		mockStore.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+		mockAPIKeyStore.AssertExpectations(t)
+	})
+
 	t.Run("should return 400 if payload is not a valid URL (e.g., 'aaa')", func(t *testing.T) {
 		resetMocks(app)
 		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
@@ -116,12 +272,13 @@ func TestShorternURL(t *testing.T) {
 		body, _ := json.Marshal(invalidPayload)
 
 		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(app, req)
 		rr := executeRequest(req, mux)
 
 		checkResponseCode(t, http.StatusBadRequest, rr.Code)
 
-		mockCacheStore.AssertNotCalled(t, "GetByLongURLHash", mock.Anything, mock.Anything)
-		mockStore.AssertNotCalled(t, "GetByLongURL", mock.Anything, mock.Anything)
+		mockCacheStore.AssertNotCalled(t, "GetByLongURLHash", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		mockStore.AssertNotCalled(t, "GetByLongURL", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 		mockStore.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
 
 		mockCacheStore.AssertExpectations(t)
@@ -129,73 +286,1570 @@ func TestShorternURL(t *testing.T) {
 	})
 }
 
-func TestURLRedirect(t *testing.T) {
+func TestShorternURLWithAlias(t *testing.T) {
 	app := newTestApplication(t, config{redisCfg: redisConfig{enable: true}})
 	mux := app.mount()
 
-	shortCode := "abcxyz"
-	longURL := "https://google.com"
-	testURL := &store.URL{
-		ShortURL: shortCode,
-		LongURL:  longURL,
-	}
+	longURL := "https://google.com/spring"
 
-	t.Run("should redirect (308) when URL exists in cache", func(t *testing.T) {
+	t.Run("should return 201 and store the alias as short URL", func(t *testing.T) {
 		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
 		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
 
-		// Setup: Cache Hit
-		mockCacheStore.On("GetByShortURL", mock.Anything, shortCode).Return(testURL, nil).Once()
+		isAlias := mock.MatchedBy(func(u *store.URL) bool {
+			return u.ShortURL == "spring-sale" && u.IsCustom
+		})
+		mockStore.On("Create", mock.Anything, isAlias).Return(nil).Once()
+		mockCacheStore.On("Set", mock.Anything, isAlias).Return(nil).Once()
 
-		req, _ := http.NewRequest(http.MethodGet, "/v1/urls/"+shortCode, nil)
+		body, _ := json.Marshal(ShorternURLPayload{LongURL: longURL, Alias: "spring-sale"})
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(app, req)
 		rr := executeRequest(req, mux)
 
-		checkResponseCode(t, http.StatusPermanentRedirect, rr.Code)
+		checkResponseCode(t, http.StatusCreated, rr.Code)
 
-		if rr.Header().Get("Location") != longURL {
-			t.Errorf("expected location %s, got %s", longURL, rr.Header().Get("Location"))
+		mockCacheStore.AssertNotCalled(t, "GetByLongURLHash", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		mockStore.AssertNotCalled(t, "GetByLongURL", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		mockCacheStore.AssertExpectations(t)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("should return 409 if alias is already in use", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		mockStore.On("Create", mock.Anything, mock.Anything).Return(store.ErrConflict).Once()
+
+		body, _ := json.Marshal(ShorternURLPayload{LongURL: longURL, Alias: "spring-sale"})
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusConflict, rr.Code)
+
+		mockCacheStore.AssertNotCalled(t, "Set", mock.Anything, mock.Anything)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("should return 400 if alias has the form of a generated code", func(t *testing.T) {
+		for _, alias := range []string{app.codes.Code(app.idGenerator.Generate()), "springsale1"} {
+			resetMocks(app)
+			mockStore := app.store.URL.(*store.MockURLStore)
+
+			body, _ := json.Marshal(ShorternURLPayload{LongURL: longURL, Alias: alias})
+			req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+			authorize(app, req)
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, http.StatusBadRequest, rr.Code)
+			mockStore.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
 		}
+	})
 
-		mockCacheStore.AssertExpectations(t)
+	t.Run("should return 400 if alias is invalid or reserved", func(t *testing.T) {
+		for _, alias := range []string{"ab", "spring-sale-summer-2025", "spring sale", "a/b", "health", "Swagger", "v1"} {
+			resetMocks(app)
+			mockStore := app.store.URL.(*store.MockURLStore)
+
+			body, _ := json.Marshal(ShorternURLPayload{LongURL: longURL, Alias: alias})
+			req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+			authorize(app, req)
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, http.StatusBadRequest, rr.Code)
+			mockStore.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+		}
 	})
+}
 
-	t.Run("should redirect (308) when cache miss but exists in DB", func(t *testing.T) {
+func TestShortCodeStrategies(t *testing.T) {
+	app := newTestApplication(t, config{redisCfg: redisConfig{enable: true}})
+	mux := app.mount()
+
+	longURL := "https://google.com/random"
+	longURLHash := store.ComputeHash(longURL)
+	body, _ := json.Marshal(ShorternURLPayload{LongURL: longURL})
+
+	t.Run("should draw another random code if the first is taken", func(t *testing.T) {
 		resetMocks(app)
 		mockStore := app.store.URL.(*store.MockURLStore)
 		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
 
-		// Setup: Cache Miss -> DB Hit -> Set Cache
-		mockCacheStore.On("GetByShortURL", mock.Anything, shortCode).Return(nil, nil).Once()
-		mockStore.On("GetByShortURL", mock.Anything, shortCode).Return(testURL, nil).Once()
-		mockCacheStore.On("Set", mock.Anything, testURL).Return(nil).Once()
+		sequential := app.codes
+		app.codes, _ = idgen.NewRandomCodes(alphabet.Base62, 8)
+		t.Cleanup(func() { app.codes = sequential })
 
-		req, _ := http.NewRequest(http.MethodGet, "/v1/urls/"+shortCode, nil)
+		var drawn []string
+		recordCode := func(args mock.Arguments) {
+			drawn = append(drawn, args.Get(1).(*store.URL).ShortURL)
+		}
+
+		mockCacheStore.On("GetByLongURLHash", mock.Anything, testAPIKeyOwner.ID, "", longURLHash).Return(nil, nil)
+		mockStore.On("GetByLongURL", mock.Anything, testAPIKeyOwner.ID, "", longURL).Return(nil, store.ErrNotFound)
+		mockCacheStore.On("LockLongURL", mock.Anything, testAPIKeyOwner.ID, "", longURLHash).Return(func() {}, nil).Once()
+		mockStore.On("Create", mock.Anything, mock.Anything).Run(recordCode).Return(store.ErrConflict).Once()
+		mockStore.On("Create", mock.Anything, mock.Anything).Run(recordCode).Return(nil).Once()
+		mockCacheStore.On("Set", mock.Anything, mock.Anything).Return(nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(app, req)
 		rr := executeRequest(req, mux)
 
-		checkResponseCode(t, http.StatusPermanentRedirect, rr.Code)
-		if rr.Header().Get("Location") != longURL {
-			t.Errorf("expected location %s, got %s", longURL, rr.Header().Get("Location"))
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		if len(drawn) != 2 || drawn[0] == drawn[1] || len(drawn[1]) != 8 {
+			t.Fatalf("expected two distinct 8 character codes, got %q", drawn)
+		}
+
+		var resp struct {
+			Data URLResponse `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Data.ShortURL != drawn[1] {
+			t.Errorf("expected short URL %q, got %q", drawn[1], resp.Data.ShortURL)
 		}
 
 		mockCacheStore.AssertExpectations(t)
 		mockStore.AssertExpectations(t)
 	})
 
-	t.Run("should return 404 if URL does not exist anywhere", func(t *testing.T) {
+	t.Run("should return 500 if every code drawn is taken", func(t *testing.T) {
 		resetMocks(app)
 		mockStore := app.store.URL.(*store.MockURLStore)
 		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
 
-		// Setup: Cache Miss -> DB Miss (ErrNotFound)
-		mockCacheStore.On("GetByShortURL", mock.Anything, "nonexistent").Return(nil, nil).Once()
-		mockStore.On("GetByShortURL", mock.Anything, "nonexistent").Return(nil, store.ErrNotFound).Once()
+		mockCacheStore.On("GetByLongURLHash", mock.Anything, testAPIKeyOwner.ID, "", longURLHash).Return(nil, nil)
+		mockStore.On("GetByLongURL", mock.Anything, testAPIKeyOwner.ID, "", longURL).Return(nil, store.ErrNotFound)
+		mockCacheStore.On("LockLongURL", mock.Anything, testAPIKeyOwner.ID, "", longURLHash).Return(func() {}, nil).Once()
+		mockStore.On("Create", mock.Anything, mock.Anything).Return(store.ErrConflict).Times(maxCodeAttempts)
 
-		req, _ := http.NewRequest(http.MethodGet, "/v1/urls/nonexistent", nil)
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(app, req)
 		rr := executeRequest(req, mux)
 
-		checkResponseCode(t, http.StatusNotFound, rr.Code)
+		checkResponseCode(t, http.StatusInternalServerError, rr.Code)
+
+		mockCacheStore.AssertNotCalled(t, "Set", mock.Anything, mock.Anything)
+		mockStore.AssertExpectations(t)
+	})
+}
+
+func TestCodeStrategyChange(t *testing.T) {
+	app := newTestApplication(t, config{redisCfg: redisConfig{enable: true}})
+	mux := app.mount()
+
+	sequential := app.codes
+	feistel, err := idgen.NewFeistelCodes(alphabet.Base62, 0, "0123456789abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.codes = sequential })
+
+	for name, change := range map[string][2]idgen.CodeGenerator{
+		"should redirect sequential codes once codes are feistel": {sequential, feistel},
+		"should redirect feistel codes once codes are sequential": {feistel, sequential},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resetMocks(app)
+			mockStore := app.store.URL.(*store.MockURLStore)
+			mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+			longURL := "https://google.com/" + strings.ReplaceAll(name, " ", "-")
+			longURLHash := store.ComputeHash(longURL)
+
+			var created *store.URL
+			mockCacheStore.On("GetByLongURLHash", mock.Anything, testAPIKeyOwner.ID, "", longURLHash).Return(nil, nil)
+			mockStore.On("GetByLongURL", mock.Anything, testAPIKeyOwner.ID, "", longURL).Return(nil, store.ErrNotFound)
+			mockCacheStore.On("LockLongURL", mock.Anything, testAPIKeyOwner.ID, "", longURLHash).Return(func() {}, nil).Once()
+			mockStore.On("Create", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				created = args.Get(1).(*store.URL)
+			}).Return(nil).Once()
+			mockCacheStore.On("Set", mock.Anything, mock.Anything).Return(nil).Once()
+
+			app.codes = change[0]
+			body, _ := json.Marshal(ShorternURLPayload{LongURL: longURL})
+			req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+			authorize(app, req)
+			checkResponseCode(t, http.StatusCreated, executeRequest(req, mux).Code)
+
+			resetMocks(app)
+			mockStore = app.store.URL.(*store.MockURLStore)
+			mockCacheStore = app.cacheStorage.URL.(*cache.MockURLStore)
+
+			// The code may decode under the new strategy, to the ID of no link
+			mockCacheStore.On("GetByShortURL", mock.Anything, "", created.ShortURL).Return(nil, nil).Once()
+			mockStore.On("GetByID", mock.Anything, mock.Anything).Return(nil, store.ErrNotFound).Maybe()
+			mockStore.On("GetByShortURL", mock.Anything, "", created.ShortURL).Return(created, nil).Once()
+			mockCacheStore.On("Set", mock.Anything, created).Return(nil).Once()
+			app.clicks.(*analytics.MockRecorder).On("Record", mock.Anything).Once()
+
+			app.codes = change[1]
+			req, _ = http.NewRequest(http.MethodGet, "/"+created.ShortURL, nil)
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, http.StatusPermanentRedirect, rr.Code)
+			if rr.Header().Get("Location") != longURL {
+				t.Errorf("expected location %s, got %s", longURL, rr.Header().Get("Location"))
+			}
+			mockCacheStore.AssertExpectations(t)
+			mockStore.AssertExpectations(t)
+		})
+	}
+}
+
+func TestShorternURLWithExpiry(t *testing.T) {
+	app := newTestApplication(t, config{redisCfg: redisConfig{enable: true}})
+	mux := app.mount()
+
+	longURL := "https://google.com/reset"
+
+	t.Run("should return 201 with expires_at derived from ttl_seconds", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		expiresSoon := mock.MatchedBy(func(u *store.URL) bool {
+			return u.ExpiresAt != nil && time.Until(*u.ExpiresAt) <= time.Hour && time.Until(*u.ExpiresAt) > 0
+		})
+		mockStore.On("Create", mock.Anything, expiresSoon).Return(nil).Once()
+		mockCacheStore.On("Set", mock.Anything, expiresSoon).Return(nil).Once()
+
+		body, _ := json.Marshal(ShorternURLPayload{LongURL: longURL, TTLSeconds: 3600})
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		mockStore.AssertNotCalled(t, "GetByLongURL", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		mockCacheStore.AssertExpectations(t)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("should return 400 if expires_at is in the past", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+
+		past := time.Now().Add(-time.Minute)
+		body, _ := json.Marshal(ShorternURLPayload{LongURL: longURL, ExpiresAt: &past})
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+		mockStore.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("should return 400 if both ttl_seconds and expires_at are set", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+
+		future := time.Now().Add(time.Hour)
+		body, _ := json.Marshal(ShorternURLPayload{LongURL: longURL, TTLSeconds: 60, ExpiresAt: &future})
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+		mockStore.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("should return 400 if redirect_type is not a redirect status", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+
+		body, _ := json.Marshal(ShorternURLPayload{LongURL: longURL, RedirectType: http.StatusOK})
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+		mockStore.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+}
+
+func TestCustomDomains(t *testing.T) {
+	app := newTestApplication(t, config{
+		apiURL:   "https://sho.rt",
+		domains:  []string{"acme.link"},
+		redisCfg: redisConfig{enable: true},
+	})
+	mux := app.mount()
+
+	longURL := "https://google.com/"
+	longURLHash := store.ComputeHash(longURL)
+
+	t.Run("should create links on a branded domain", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		mockCacheStore.On("GetByLongURLHash", mock.Anything, testAPIKeyOwner.ID, "acme.link", longURLHash).Return(nil, nil)
+		mockStore.On("GetByLongURL", mock.Anything, testAPIKeyOwner.ID, "acme.link", longURL).Return(nil, store.ErrNotFound)
+		mockCacheStore.On("LockLongURL", mock.Anything, testAPIKeyOwner.ID, "acme.link", longURLHash).Return(func() {}, nil).Once()
+		mockStore.On("Create", mock.Anything, mock.MatchedBy(func(u *store.URL) bool {
+			return u.Domain == "acme.link"
+		})).Return(nil).Once()
+		mockCacheStore.On("Set", mock.Anything, mock.Anything).Return(nil).Once()
+
+		body, _ := json.Marshal(ShorternURLPayload{LongURL: longURL, Domain: "ACME.link"})
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		var res struct {
+			Data URLResponse `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Data.Link != "https://acme.link/"+res.Data.ShortURL {
+			t.Errorf("expected a link on acme.link, got %s", res.Data.Link)
+		}
 
 		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("should return 400 for a domain that is not served", func(t *testing.T) {
+		resetMocks(app)
+
+		body, _ := json.Marshal(ShorternURLPayload{LongURL: longURL, Domain: "evil.example"})
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+		app.store.URL.(*store.MockURLStore).AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("should redirect links of the domain of the Host header", func(t *testing.T) {
+		resetMocks(app)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		mockCacheStore.On("GetByShortURL", mock.Anything, "acme.link", "sale").Return(&store.URL{Domain: "acme.link", ShortURL: "sale", LongURL: longURL}, nil).Once()
+		app.clicks.(*analytics.MockRecorder).On("Record", mock.Anything).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/sale", nil)
+		req.Host = "acme.link"
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusPermanentRedirect, rr.Code)
 		mockCacheStore.AssertExpectations(t)
 	})
+
+	t.Run("should look links up on the domain of the query", func(t *testing.T) {
+		resetMocks(app)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		mockCacheStore.On("GetByShortURL", mock.Anything, "acme.link", "sale").Return(&store.URL{Domain: "acme.link", ShortURL: "sale", LongURL: longURL}, nil).Once()
+		app.clicks.(*analytics.MockRecorder).On("Record", mock.Anything).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/v1/urls/sale?domain=acme.link", nil)
+		req.Host = "sho.rt"
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusPermanentRedirect, rr.Code)
+		mockCacheStore.AssertExpectations(t)
+
+		req, _ = http.NewRequest(http.MethodGet, "/v1/urls/sale?domain=evil.example", nil)
+		rr = executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestShortLinks(t *testing.T) {
+	app := newTestApplication(t, config{
+		apiURL:      "api.sho.rt",
+		publicURL:   "https://sho.rt/s/",
+		redisCfg:    redisConfig{enable: true},
+		destination: destinationConfig{maxChainDepth: 1},
+	})
+	mux := app.mount()
+
+	t.Run("should return the link under the public base URL", func(t *testing.T) {
+		resetMocks(app)
+		app.store.URL.(*store.MockURLStore).On("Create", mock.Anything, mock.Anything).Return(nil).Once()
+		app.cacheStorage.URL.(*cache.MockURLStore).On("Set", mock.Anything, mock.Anything).Return(nil).Once()
+
+		body, _ := json.Marshal(ShorternURLPayload{LongURL: "https://google.com/", Alias: "spring"})
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+		if rr.Header().Get("Location") != "https://sho.rt/s/spring" {
+			t.Errorf("expected Location https://sho.rt/s/spring, got %s", rr.Header().Get("Location"))
+		}
+	})
+
+	t.Run("should return the link in the info of a URL", func(t *testing.T) {
+		resetMocks(app)
+		testURL := &store.URL{OwnerID: testAPIKeyOwner.ID, ShortURL: "spring", LongURL: "https://google.com/"}
+		app.cacheStorage.URL.(*cache.MockURLStore).On("GetByShortURL", mock.Anything, "", "spring").Return(testURL, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/v1/urls/spring/info", nil)
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var res struct {
+			Data URLResponse `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Data.Link != "https://sho.rt/s/spring" {
+			t.Errorf("expected link https://sho.rt/s/spring, got %s", res.Data.Link)
+		}
+	})
+
+	t.Run("should resolve links to our own short links under the path prefix", func(t *testing.T) {
+		resetMocks(app)
+		target := &store.URL{ShortURL: "spring", LongURL: "https://google.com/"}
+		app.cacheStorage.URL.(*cache.MockURLStore).On("GetByShortURL", mock.Anything, "", "spring").Return(target, nil).Once()
+
+		longURL, err := app.validateDestination(context.Background(), "https://sho.rt/s/spring")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if longURL != target.LongURL {
+			t.Errorf("expected %s, got %s", target.LongURL, longURL)
+		}
+	})
+}
+
+func TestShortURLValidation(t *testing.T) {
+	app := newTestApplication(t, config{redisCfg: redisConfig{enable: true}})
+	mux := app.mount()
+
+	longURL := "https://google.com"
+	id := app.idGenerator.Generate()
+	code := app.codes.Code(id)
+
+	t.Run("should return 404 without any lookup for codes no link can have", func(t *testing.T) {
+		// Of the form of codes, but past the largest 64-bit number
+		for _, shortCode := range []string{"a", "abcdefghijklmnopq", "abc.def", "zzzzzzzzzzzzzzzzz", "zzzzzzzzzzz"} {
+			resetMocks(app)
+			mockStore := app.store.URL.(*store.MockURLStore)
+			mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+			req, _ := http.NewRequest(http.MethodGet, "/"+shortCode, nil)
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, http.StatusNotFound, rr.Code)
+			mockCacheStore.AssertNotCalled(t, "GetByShortURL", mock.Anything, mock.Anything, mock.Anything)
+			mockStore.AssertNotCalled(t, "GetByShortURL", mock.Anything, mock.Anything, mock.Anything)
+			mockStore.AssertNotCalled(t, "GetByID", mock.Anything, mock.Anything)
+			if len(mockStore.Calls) != 0 {
+				t.Errorf("expected no store call for %q, got %d", shortCode, len(mockStore.Calls))
+			}
+		}
+	})
+
+	t.Run("should look generated codes up by ID", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		testURL := &store.URL{ID: id, ShortURL: code, LongURL: longURL}
+
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", code).Return(nil, nil).Once()
+		mockStore.On("GetByID", mock.Anything, id).Return(testURL, nil).Once()
+		mockCacheStore.On("Set", mock.Anything, testURL).Return(nil).Once()
+		app.clicks.(*analytics.MockRecorder).On("Record", mock.Anything).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/"+code, nil)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusPermanentRedirect, rr.Code)
+		mockStore.AssertNotCalled(t, "GetByShortURL", mock.Anything, mock.Anything, mock.Anything)
+		mockCacheStore.AssertExpectations(t)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("should look a code missing by ID up by short URL and remember the miss", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		// The code of another strategy may decode to an ID no link has
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", code).Return(nil, nil).Once()
+		mockStore.On("GetByID", mock.Anything, id).Return(nil, store.ErrNotFound).Once()
+		mockStore.On("GetByShortURL", mock.Anything, "", code).Return(nil, store.ErrNotFound).Once()
+		mockCacheStore.On("SetMissing", mock.Anything, "", code).Return(nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/"+code, nil)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+		mockCacheStore.AssertExpectations(t)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("should look codes that may be of another strategy up by short URL", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		// Too far in the future for a sequential code, yet a feistel one
+		future := alphabet.Base62.Encode(1<<63 - 1)
+		testURL := &store.URL{ID: id, ShortURL: future, LongURL: longURL}
+
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", future).Return(nil, nil).Once()
+		mockStore.On("GetByShortURL", mock.Anything, "", future).Return(testURL, nil).Once()
+		mockCacheStore.On("Set", mock.Anything, testURL).Return(nil).Once()
+		app.clicks.(*analytics.MockRecorder).On("Record", mock.Anything).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/"+future, nil)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusPermanentRedirect, rr.Code)
+		mockStore.AssertNotCalled(t, "GetByID", mock.Anything, mock.Anything)
+		mockCacheStore.AssertExpectations(t)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("should return 404 if the ID of a code is another link's", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", code).Return(nil, nil).Once()
+		mockStore.On("GetByID", mock.Anything, id).Return(&store.URL{ID: id, Domain: "go.brand.com", ShortURL: code}, nil).Once()
+		mockCacheStore.On("SetMissing", mock.Anything, "", code).Return(nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/"+code, nil)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+		mockStore.AssertNotCalled(t, "GetByShortURL", mock.Anything, mock.Anything, mock.Anything)
+		mockCacheStore.AssertExpectations(t)
+		mockStore.AssertExpectations(t)
+	})
+}
+
+func TestURLRedirect(t *testing.T) {
+	app := newTestApplication(t, config{redisCfg: redisConfig{enable: true}})
+	mux := app.mount()
+
+	shortCode := "abcxyz"
+	longURL := "https://google.com"
+	testURL := &store.URL{
+		ShortURL: shortCode,
+		LongURL:  longURL,
+	}
+
+	t.Run("should redirect (308) when URL exists in cache", func(t *testing.T) {
+		resetMocks(app)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		mockRecorder := app.clicks.(*analytics.MockRecorder)
+
+		// Setup: Cache Hit
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", shortCode).Return(testURL, nil).Once()
+		mockRecorder.On("Record", mock.MatchedBy(func(c *store.Click) bool {
+			return c.ShortURL == shortCode && c.Referrer == "https://news.ycombinator.com" && c.IP == "203.0.113.7"
+		})).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/v1/urls/"+shortCode, nil)
+		req.Header.Set("Referer", "https://news.ycombinator.com")
+		req.Header.Set("X-Real-IP", "203.0.113.7")
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusPermanentRedirect, rr.Code)
+
+		if rr.Header().Get("Location") != longURL {
+			t.Errorf("expected location %s, got %s", longURL, rr.Header().Get("Location"))
+		}
+
+		mockCacheStore.AssertExpectations(t)
+		mockRecorder.AssertExpectations(t)
+	})
+
+	t.Run("should redirect (308) when cache miss but exists in DB", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		// Setup: Cache Miss -> DB Hit -> Set Cache
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", shortCode).Return(nil, nil).Once()
+		mockStore.On("GetByShortURL", mock.Anything, "", shortCode).Return(testURL, nil).Once()
+		mockCacheStore.On("Set", mock.Anything, testURL).Return(nil).Once()
+		app.clicks.(*analytics.MockRecorder).On("Record", mock.Anything).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/v1/urls/"+shortCode, nil)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusPermanentRedirect, rr.Code)
+		if rr.Header().Get("Location") != longURL {
+			t.Errorf("expected location %s, got %s", longURL, rr.Header().Get("Location"))
+		}
+
+		mockCacheStore.AssertExpectations(t)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("should return 404 if URL does not exist anywhere", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		// Setup: Cache Miss -> DB Miss (ErrNotFound) -> Cache the miss
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", "missing-alias").Return(nil, nil).Once()
+		mockStore.On("GetByShortURL", mock.Anything, "", "missing-alias").Return(nil, store.ErrNotFound).Once()
+		mockCacheStore.On("SetMissing", mock.Anything, "", "missing-alias").Return(nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/v1/urls/missing-alias", nil)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+
+		mockStore.AssertExpectations(t)
+		mockCacheStore.AssertExpectations(t)
+	})
+
+	t.Run("should return 404 without a DB lookup if URL is known missing", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", "missing-alias").Return(nil, store.ErrNotFound).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/v1/urls/missing-alias", nil)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+
+		mockStore.AssertNotCalled(t, "GetByShortURL", mock.Anything, mock.Anything, mock.Anything)
+		mockCacheStore.AssertExpectations(t)
+	})
+
+	t.Run("should return 404 without any lookup if URL is not in the bloom filter", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		app.knownLinks = bloom.New(100, 0.01)
+		t.Cleanup(func() { app.knownLinks = nil })
+		app.addKnownLinks(testURL)
+
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", shortCode).Return(testURL, nil).Once()
+		app.clicks.(*analytics.MockRecorder).On("Record", mock.Anything).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/v1/urls/missing-alias", nil)
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+
+		req, _ = http.NewRequest(http.MethodGet, "/v1/urls/"+shortCode, nil)
+		rr = executeRequest(req, mux)
+		checkResponseCode(t, http.StatusPermanentRedirect, rr.Code)
+
+		mockCacheStore.AssertNotCalled(t, "GetByShortURL", mock.Anything, "", "missing-alias")
+		mockStore.AssertNotCalled(t, "GetByShortURL", mock.Anything, mock.Anything, mock.Anything)
+		mockCacheStore.AssertExpectations(t)
+	})
+
+	t.Run("should use the link's own redirect type with no-store for temporary redirects", func(t *testing.T) {
+		resetMocks(app)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		campaignURL := &store.URL{
+			ShortURL:     "campaign",
+			LongURL:      longURL,
+			RedirectType: http.StatusFound,
+		}
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", "campaign").Return(campaignURL, nil).Once()
+		app.clicks.(*analytics.MockRecorder).On("Record", mock.Anything).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/v1/urls/campaign", nil)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusFound, rr.Code)
+		if cc := rr.Header().Get("Cache-Control"); cc != "no-store" {
+			t.Errorf("expected Cache-Control no-store, got %q", cc)
+		}
+	})
+
+	t.Run("should cap the cache lifetime of permanent redirects at the link expiry", func(t *testing.T) {
+		resetMocks(app)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		expiresAt := time.Now().Add(time.Hour)
+		expiringURL := &store.URL{
+			ShortURL:  "expiring",
+			LongURL:   longURL,
+			ExpiresAt: &expiresAt,
+		}
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", "expiring").Return(expiringURL, nil).Once()
+		app.clicks.(*analytics.MockRecorder).On("Record", mock.Anything).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/v1/urls/expiring", nil)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusPermanentRedirect, rr.Code)
+		if cc := rr.Header().Get("Cache-Control"); cc != "public, max-age=3599" && cc != "public, max-age=3600" {
+			t.Errorf("expected Cache-Control capped at one hour, got %q", cc)
+		}
+	})
+
+	t.Run("should return 410 if URL has expired", func(t *testing.T) {
+		resetMocks(app)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		expiredAt := time.Now().Add(-time.Minute)
+		expiredURL := &store.URL{
+			ShortURL:  "expired",
+			LongURL:   longURL,
+			ExpiresAt: &expiredAt,
+		}
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", "expired").Return(expiredURL, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/v1/urls/expired", nil)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusGone, rr.Code)
+		mockCacheStore.AssertExpectations(t)
+	})
+
+	t.Run("should redirect (308) from the root path", func(t *testing.T) {
+		resetMocks(app)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", shortCode).Return(testURL, nil).Once()
+		app.clicks.(*analytics.MockRecorder).On("Record", mock.Anything).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/"+shortCode, nil)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusPermanentRedirect, rr.Code)
+		mockCacheStore.AssertExpectations(t)
+	})
+}
+
+func TestPasswordProtectedURL(t *testing.T) {
+	app := newTestApplication(t, config{redisCfg: redisConfig{enable: true}})
+	mux := app.mount()
+
+	longURL := "https://docs.google.com/internal"
+
+	t.Run("should store a hash of the password and skip deduplication", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		isProtected := mock.MatchedBy(func(u *store.URL) bool {
+			return u.HasPassword() && u.PasswordHash != "hunter22" && u.CheckPassword("hunter22")
+		})
+		mockStore.On("Create", mock.Anything, isProtected).Return(nil).Once()
+		mockCacheStore.On("Set", mock.Anything, isProtected).Return(nil).Once()
+
+		body, _ := json.Marshal(ShorternURLPayload{LongURL: longURL, Password: "hunter22"})
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+		if bytes.Contains(rr.Body.Bytes(), []byte("$2a$")) {
+			t.Error("expected the password hash to be left out of the response")
+		}
+
+		mockStore.AssertNotCalled(t, "GetByLongURL", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("should return 400 if the password is longer than bcrypt allows", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+
+		// 40 characters, 80 bytes
+		body, _ := json.Marshal(ShorternURLPayload{LongURL: longURL, Password: strings.Repeat("é", 40)})
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+		mockStore.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	protectedURL := &store.URL{ID: 1, ShortURL: "secret", LongURL: longURL}
+	if err := protectedURL.SetPassword("hunter22"); err != nil {
+		t.Fatal(err)
+	}
+
+	submit := func(password string) *httptest.ResponseRecorder {
+		form := strings.NewReader("password=" + password)
+		req, _ := http.NewRequest(http.MethodPost, "/secret", form)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return executeRequest(req, mux)
+	}
+
+	t.Run("should serve the password form instead of redirecting", func(t *testing.T) {
+		resetMocks(app)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", "secret").Return(protectedURL, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/secret", nil)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+		if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html") {
+			t.Errorf("expected an HTML form, got %q", rr.Header().Get("Content-Type"))
+		}
+		app.clicks.(*analytics.MockRecorder).AssertNotCalled(t, "Record", mock.Anything)
+	})
+
+	t.Run("should unlock the link with the right password", func(t *testing.T) {
+		resetMocks(app)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", "secret").Return(protectedURL, nil).Twice()
+		app.clicks.(*analytics.MockRecorder).On("Record", mock.Anything).Once()
+
+		rr := submit("hunter22")
+		checkResponseCode(t, http.StatusSeeOther, rr.Code)
+
+		cookies := rr.Result().Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("expected an unlock cookie, got %v", cookies)
+		}
+		if cookies[0].Secure {
+			t.Error("expected the unlock cookie to be sent over HTTP when the public URL is")
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, "/secret", nil)
+		req.AddCookie(cookies[0])
+		rr = executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusPermanentRedirect, rr.Code)
+		if cc := rr.Header().Get("Cache-Control"); cc != "no-store" {
+			t.Errorf("expected Cache-Control no-store, got %q", cc)
+		}
+	})
+
+	t.Run("should mark the unlock cookie Secure behind a TLS-terminating proxy", func(t *testing.T) {
+		app := newTestApplication(t, config{
+			password: passwordConfig{cookieTTL: "1h", maxAttempts: 3, attemptWindow: "15m", secureCookie: true},
+		})
+		mux := app.mount()
+
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", "secret").Return(protectedURL, nil).Once()
+
+		// Plain HTTP from the proxy, r.TLS is nil
+		form := strings.NewReader("password=hunter22")
+		req, _ := http.NewRequest(http.MethodPost, "/secret", form)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusSeeOther, rr.Code)
+		if cookies := rr.Result().Cookies(); len(cookies) != 1 || !cookies[0].Secure {
+			t.Errorf("expected a Secure unlock cookie, got %v", cookies)
+		}
+	})
+
+	t.Run("should block the link after too many wrong passwords", func(t *testing.T) {
+		resetMocks(app)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", "secret").Return(protectedURL, nil)
+
+		for range app.config.password.maxAttempts {
+			checkResponseCode(t, http.StatusUnauthorized, submit("wrong").Code)
+		}
+
+		rr := submit("hunter22")
+		checkResponseCode(t, http.StatusTooManyRequests, rr.Code)
+		if rr.Header().Get("Retry-After") == "" {
+			t.Error("expected a Retry-After header")
+		}
+	})
+}
+
+func TestMaxClicksURL(t *testing.T) {
+	app := newTestApplication(t, config{redisCfg: redisConfig{enable: true}})
+	mux := app.mount()
+
+	maxClicks := 1
+	oneTimeURL := &store.URL{ID: 1, ShortURL: "once", LongURL: "https://google.com", MaxClicks: &maxClicks}
+
+	t.Run("should store max_clicks and skip deduplication", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		isLimited := mock.MatchedBy(func(u *store.URL) bool {
+			return u.MaxClicks != nil && *u.MaxClicks == 1
+		})
+		mockStore.On("Create", mock.Anything, isLimited).Return(nil).Once()
+		mockCacheStore.On("Set", mock.Anything, isLimited).Return(nil).Once()
+
+		body, _ := json.Marshal(ShorternURLPayload{LongURL: oneTimeURL.LongURL, MaxClicks: 1})
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+		mockStore.AssertNotCalled(t, "GetByLongURL", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("should redirect and cache the clicks left when no counter is cached", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", "once").Return(oneTimeURL, nil).Once()
+		mockCacheStore.On("DecrClicks", mock.Anything, "", "once").Return(int64(0), false, nil).Once()
+		mockStore.On("ConsumeClick", mock.Anything, oneTimeURL.ID).Return(1, nil).Once()
+		mockCacheStore.On("SetClicks", mock.Anything, oneTimeURL, int64(0)).Return(nil).Once()
+		app.clicks.(*analytics.MockRecorder).On("Record", mock.Anything).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/once", nil)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusPermanentRedirect, rr.Code)
+		if cc := rr.Header().Get("Cache-Control"); cc != "no-store" {
+			t.Errorf("expected Cache-Control no-store, got %q", cc)
+		}
+		mockStore.AssertExpectations(t)
+		mockCacheStore.AssertExpectations(t)
+	})
+
+	t.Run("should return 410 without a database write once the cached counter is used up", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", "once").Return(oneTimeURL, nil).Once()
+		mockCacheStore.On("DecrClicks", mock.Anything, "", "once").Return(int64(-1), true, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/once", nil)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusGone, rr.Code)
+		mockStore.AssertNotCalled(t, "ConsumeClick", mock.Anything, mock.Anything)
+		app.clicks.(*analytics.MockRecorder).AssertNotCalled(t, "Record", mock.Anything)
+	})
+
+	t.Run("should return 410 and reset the counter when the database has no clicks left", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", "once").Return(oneTimeURL, nil).Once()
+		mockCacheStore.On("DecrClicks", mock.Anything, "", "once").Return(int64(3), true, nil).Once()
+		mockStore.On("ConsumeClick", mock.Anything, oneTimeURL.ID).Return(0, store.ErrClicksExhausted).Once()
+		mockCacheStore.On("SetClicks", mock.Anything, oneTimeURL, int64(0)).Return(nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/once", nil)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusGone, rr.Code)
+		mockCacheStore.AssertExpectations(t)
+	})
+}
+
+func TestUnsafeURL(t *testing.T) {
+	app := newTestApplication(t, config{redisCfg: redisConfig{enable: true}})
+	app.safety = safety.NewDomainBlocklist([]string{"phish.example"})
+	mux := app.mount()
+
+	t.Run("should return 422 when shortening a blocked URL", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+
+		body, _ := json.Marshal(ShorternURLPayload{LongURL: "https://login.phish.example/bank"})
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+		if !strings.Contains(rr.Body.String(), "blocklisted") {
+			t.Errorf("expected the reason in the error, got %s", rr.Body.String())
+		}
+		mockStore.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("should mark blocked URLs of a batch", func(t *testing.T) {
+		resetMocks(app)
+
+		body, _ := json.Marshal(ShorternURLsBatchPayload{LongURLs: []string{"https://phish.example/a", "https://phish.example/a"}})
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten/batch", bytes.NewBuffer(body))
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var res struct {
+			Data []BatchShortenResult `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range res.Data {
+			if r.Status != batchStatusBlocked || r.URL != nil {
+				t.Errorf("expected a blocked result, got %+v", r)
+			}
+		}
+	})
+
+	t.Run("should serve a warning page for a flagged URL", func(t *testing.T) {
+		resetMocks(app)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		flaggedURL := &store.URL{ID: 1, ShortURL: "flagged", LongURL: "https://google.com", FlaggedReason: "phishing"}
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", "flagged").Return(flaggedURL, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/flagged", nil)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+		if rr.Header().Get("Location") != "" || !strings.Contains(rr.Body.String(), "phishing") {
+			t.Errorf("expected a warning page, got %s", rr.Body.String())
+		}
+		app.clicks.(*analytics.MockRecorder).AssertNotCalled(t, "Record", mock.Anything)
+	})
+}
+
+func TestSelfReferentialURL(t *testing.T) {
+	app := newTestApplication(t, config{
+		apiURL: "sho.rt",
+		destination: destinationConfig{
+			maxChainDepth:           2,
+			shortenerDomains:        []string{"bit.ly", "tinyurl.com"},
+			allowedShortenerDomains: []string{"bit.ly"},
+		},
+	})
+	mux := app.mount()
+
+	shorten := func(longURL string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(ShorternURLPayload{LongURL: longURL, Alias: "my-link"})
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten", bytes.NewBuffer(body))
+		authorize(app, req)
+		return executeRequest(req, mux)
+	}
+
+	link := func(code, longURL string) {
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", code).Return(&store.URL{ShortURL: code, LongURL: longURL}, nil).Once()
+	}
+
+	t.Run("should store the target of a link to one of our short links", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		link("abc", "https://sho.rt/v1/urls/bcd")
+		link("bcd", "https://google.com")
+
+		isResolved := mock.MatchedBy(func(u *store.URL) bool {
+			return u.LongURL == "https://google.com/"
+		})
+		mockStore.On("Create", mock.Anything, isResolved).Return(nil).Once()
+		mockCacheStore.On("Set", mock.Anything, isResolved).Return(nil).Once()
+
+		rr := shorten("https://SHO.RT/abc")
+
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("should return 422 if the chain of short links is too long", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+
+		link("abc", "https://sho.rt/bcd")
+		link("bcd", "https://sho.rt/abc")
+
+		rr := shorten("https://sho.rt/abc")
+
+		checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+		mockStore.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("should return 422 for a link to our own host that is not a short link", func(t *testing.T) {
+		resetMocks(app)
+
+		rr := shorten("https://sho.rt/v1/health")
+
+		checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	t.Run("should reject other shorteners unless allowed", func(t *testing.T) {
+		resetMocks(app)
+
+		checkResponseCode(t, http.StatusUnprocessableEntity, shorten("https://www.tinyurl.com/abc").Code)
+
+		mockStore := app.store.URL.(*store.MockURLStore)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+		mockStore.On("Create", mock.Anything, mock.Anything).Return(nil).Once()
+		mockCacheStore.On("Set", mock.Anything, mock.Anything).Return(nil).Once()
+
+		checkResponseCode(t, http.StatusCreated, shorten("https://bit.ly/abc").Code)
+	})
+}
+
+func TestURLQRCode(t *testing.T) {
+	app := newTestApplication(t, config{apiURL: "sho.rt"})
+	mux := app.mount()
+
+	testURL := &store.URL{
+		ID:       12345,
+		ShortURL: "abcxyz",
+		LongURL:  "https://google.com",
+	}
+
+	t.Run("should render a PNG of the requested size with an ETag", func(t *testing.T) {
+		resetMocks(app)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", testURL.ShortURL).Return(testURL, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/v1/urls/abcxyz/qr?size=300&level=h", nil)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+		if ct := rr.Header().Get("Content-Type"); ct != "image/png" {
+			t.Errorf("expected image/png, got %q", ct)
+		}
+		if rr.Header().Get("ETag") == "" {
+			t.Error("expected an ETag header")
+		}
+
+		img, err := png.Decode(rr.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b := img.Bounds(); b.Dx() != 300 || b.Dy() != 300 {
+			t.Errorf("expected a 300x300 image, got %v", b)
+		}
+	})
+
+	t.Run("should return 410 if URL has expired", func(t *testing.T) {
+		resetMocks(app)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		expiredAt := time.Now().Add(-time.Minute)
+		expiredURL := &store.URL{ID: 12346, ShortURL: "expired", LongURL: "https://google.com", ExpiresAt: &expiredAt}
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", expiredURL.ShortURL).Return(expiredURL, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/v1/urls/expired/qr", nil)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusGone, rr.Code)
+		if ct := rr.Header().Get("Content-Type"); ct == "image/png" {
+			t.Error("expected no QR code for an expired link")
+		}
+	})
+
+	t.Run("should return 304 when the ETag matches", func(t *testing.T) {
+		resetMocks(app)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", testURL.ShortURL).Return(testURL, nil).Twice()
+
+		req, _ := http.NewRequest(http.MethodGet, "/v1/urls/abcxyz/qr?format=svg", nil)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+		if ct := rr.Header().Get("Content-Type"); ct != "image/svg+xml" {
+			t.Errorf("expected image/svg+xml, got %q", ct)
+		}
+
+		req, _ = http.NewRequest(http.MethodGet, "/v1/urls/abcxyz/qr?format=svg", nil)
+		req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+		rr = executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNotModified, rr.Code)
+	})
+
+	t.Run("should return 400 for invalid options", func(t *testing.T) {
+		for _, query := range []string{"format=gif", "size=10", "level=X", "margin=-1"} {
+			resetMocks(app)
+			mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+			mockCacheStore.On("GetByShortURL", mock.Anything, "", testURL.ShortURL).Return(testURL, nil).Once()
+
+			req, _ := http.NewRequest(http.MethodGet, "/v1/urls/abcxyz/qr?"+query, nil)
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+func TestURLStats(t *testing.T) {
+	app := newTestApplication(t, config{redisCfg: redisConfig{enable: true}})
+	mux := app.mount()
+
+	testURL := &store.URL{
+		ID:       12345,
+		OwnerID:  testAPIKeyOwner.ID,
+		ShortURL: "abcxyz",
+		LongURL:  "https://google.com",
+	}
+
+	t.Run("should return 200 with click stats", func(t *testing.T) {
+		resetMocks(app)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+		mockClickStore := app.store.Clicks.(*store.MockClickStore)
+
+		stats := &store.ClickStats{
+			Total:      3,
+			ByDay:      []store.DailyClicks{{Day: "2025-12-26", Clicks: 3}},
+			ByReferrer: []store.ReferrerClicks{{Referrer: "", Clicks: 3}},
+		}
+
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", testURL.ShortURL).Return(testURL, nil).Once()
+		mockClickStore.On("GetStats", mock.Anything, testURL.ID, mock.MatchedBy(func(since time.Time) bool {
+			return time.Since(since) < 7*24*time.Hour
+		})).Return(stats, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/v1/urls/abcxyz/stats?days=7", nil)
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var res struct {
+			Data URLStatsResponse `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Data.ShortURL != testURL.ShortURL || res.Data.Total != 3 {
+			t.Errorf("unexpected stats response: %+v", res.Data)
+		}
+
+		mockCacheStore.AssertExpectations(t)
+		mockClickStore.AssertExpectations(t)
+	})
+
+	t.Run("should return 400 if days is out of range", func(t *testing.T) {
+		resetMocks(app)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+		mockClickStore := app.store.Clicks.(*store.MockClickStore)
+
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", testURL.ShortURL).Return(testURL, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/v1/urls/abcxyz/stats?days=0", nil)
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+		mockClickStore.AssertNotCalled(t, "GetStats", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("should return 403 if URL is owned by another API key", func(t *testing.T) {
+		resetMocks(app)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+		mockClickStore := app.store.Clicks.(*store.MockClickStore)
+
+		otherURL := *testURL
+		otherURL.OwnerID = testAPIKeyOwner.ID + 1
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", testURL.ShortURL).Return(&otherURL, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/v1/urls/abcxyz/stats", nil)
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+		mockClickStore.AssertNotCalled(t, "GetStats", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestMetrics(t *testing.T) {
+	app := newTestApplication(t, config{redisCfg: redisConfig{enable: true}})
+	mux := app.mount()
+
+	testURL := &store.URL{ShortURL: "abcxyz", LongURL: "https://google.com/"}
+
+	app.cacheStorage.URL.(*cache.MockURLStore).On("GetByShortURL", mock.Anything, "", "abcxyz").Return(testURL, nil).Once()
+	app.clicks.(*analytics.MockRecorder).On("Record", mock.Anything).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "/v1/urls/abcxyz", nil)
+	checkResponseCode(t, http.StatusPermanentRedirect, executeRequest(req, mux).Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/metrics", nil)
+	rr := executeRequest(req, mux)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	for _, want := range []string{
+		`url_shorterner_http_requests_total{method="GET",route="/v1/urls/{shortURL}",status="308"} 1`,
+		`url_shorterner_cache_lookups_total{op="GetByShortURL",result="hit"} 1`,
+	} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("expected metrics to contain %s", want)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	app := newTestApplication(t, config{redisCfg: redisConfig{enable: true}})
+	app.rateLimits.redirect = ratelimit.NewMemoryLimiter(1, time.Minute)
+	mux := app.mount()
+
+	testURL := &store.URL{ShortURL: "abcxyz", LongURL: "https://google.com/"}
+	redirect := func(ip string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, "/abcxyz", nil)
+		req.Header.Set("X-Real-IP", ip)
+		return executeRequest(req, mux)
+	}
+
+	mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+	mockCacheStore.On("GetByShortURL", mock.Anything, "", "abcxyz").Return(testURL, nil).Twice()
+	app.clicks.(*analytics.MockRecorder).On("Record", mock.Anything).Twice()
+
+	rr := redirect("203.0.113.7")
+	checkResponseCode(t, http.StatusPermanentRedirect, rr.Code)
+	if rr.Header().Get("RateLimit-Limit") != "1" || rr.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("expected RateLimit headers, got %v", rr.Header())
+	}
+
+	t.Run("should return 429 once the limit is reached", func(t *testing.T) {
+		rr := redirect("203.0.113.7")
+
+		checkResponseCode(t, http.StatusTooManyRequests, rr.Code)
+		if rr.Header().Get("Retry-After") != "60" {
+			t.Errorf("expected Retry-After 60, got %q", rr.Header().Get("Retry-After"))
+		}
+	})
+
+	t.Run("should limit clients separately", func(t *testing.T) {
+		rr := redirect("203.0.113.8")
+
+		checkResponseCode(t, http.StatusPermanentRedirect, rr.Code)
+	})
+
+	mockCacheStore.AssertExpectations(t)
+
+	t.Run("should turn away invalid short URLs before counting them", func(t *testing.T) {
+		for range 2 {
+			req, _ := http.NewRequest(http.MethodGet, "/abc.def", nil)
+			req.Header.Set("X-Real-IP", "203.0.113.10")
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, http.StatusNotFound, rr.Code)
+			if rr.Header().Get("RateLimit-Limit") != "" {
+				t.Errorf("expected no rate limit to be checked, got %v", rr.Header())
+			}
+		}
+	})
+
+	t.Run("should charge batches per URL", func(t *testing.T) {
+		resetMocks(app)
+		app.rateLimits.shorten = ratelimit.NewMemoryLimiter(3, time.Minute)
+		defer func() { app.rateLimits.shorten = nil }()
+
+		body, _ := json.Marshal(ShorternURLsBatchPayload{LongURLs: []string{
+			"https://google.com/1", "https://google.com/2", "https://google.com/3", "https://google.com/4",
+		}})
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten/batch", bytes.NewBuffer(body))
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusTooManyRequests, rr.Code)
+		app.store.URL.(*store.MockURLStore).AssertNotCalled(t, "CreateMany", mock.Anything, mock.Anything)
+	})
+
+	t.Run("should limit clients by IP before checking their API key", func(t *testing.T) {
+		app := newTestApplication(t, config{redisCfg: redisConfig{enable: true}})
+		app.rateLimits.auth = ratelimit.NewMemoryLimiter(1, time.Minute)
+		mux := app.mount()
+
+		mockAPIKeyStore := app.store.APIKeys.(*store.MockAPIKeyStore)
+		mockAPIKeyStore.On("GetByHash", mock.Anything, mock.Anything).Return(nil, store.ErrNotFound).Once()
+
+		guess := func() *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(http.MethodGet, "/v1/urls", nil)
+			req.Header.Set("Authorization", "Bearer us_guessed-key")
+			req.Header.Set("X-Real-IP", "203.0.113.9")
+			return executeRequest(req, mux)
+		}
+
+		checkResponseCode(t, http.StatusUnauthorized, guess().Code)
+		checkResponseCode(t, http.StatusTooManyRequests, guess().Code)
+		mockAPIKeyStore.AssertNumberOfCalls(t, "GetByHash", 1)
+	})
+}
+
+func TestManageURLs(t *testing.T) {
+	app := newTestApplication(t, config{redisCfg: redisConfig{enable: true}})
+	mux := app.mount()
+
+	testURL := &store.URL{
+		ID:       12345,
+		OwnerID:  testAPIKeyOwner.ID,
+		ShortURL: "abcxyz",
+		LongURL:  "https://google.com",
+	}
+
+	t.Run("should list URLs with a next cursor", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+
+		urls := []*store.URL{{ID: 30}, {ID: 20}, {ID: 10}}
+		mockStore.On("List", mock.Anything, testAPIKeyOwner.ID, uint64(40), 3).Return(urls, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/v1/urls?cursor=40&limit=2", nil)
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var res struct {
+			Data ListURLsResponse `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Data.URLs) != 2 || res.Data.NextCursor != "20" {
+			t.Errorf("expected 2 urls and next cursor 20, got %d and %q", len(res.Data.URLs), res.Data.NextCursor)
+		}
+
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("should return URL info as JSON", func(t *testing.T) {
+		resetMocks(app)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", testURL.ShortURL).Return(testURL, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/v1/urls/abcxyz/info", nil)
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+		mockCacheStore.AssertExpectations(t)
+	})
+
+	t.Run("should update the long URL and invalidate cache", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		newLongURL := "https://google.com/fixed"
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", testURL.ShortURL).Return(testURL, nil).Once()
+		mockStore.On("Update", mock.Anything, mock.MatchedBy(func(u *store.URL) bool {
+			return u.ID == testURL.ID && u.LongURL == newLongURL
+		})).Return(nil).Once()
+		mockCacheStore.On("Delete", mock.Anything, testURL).Return(nil).Once()
+
+		body, _ := json.Marshal(UpdateURLPayload{LongURL: newLongURL})
+		req, _ := http.NewRequest(http.MethodPatch, "/v1/urls/abcxyz", bytes.NewBuffer(body))
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+		mockStore.AssertExpectations(t)
+		mockCacheStore.AssertExpectations(t)
+	})
+
+	t.Run("should delete the URL and invalidate cache", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", testURL.ShortURL).Return(testURL, nil).Once()
+		mockStore.On("Delete", mock.Anything, testURL.ID).Return(nil).Once()
+		mockCacheStore.On("Delete", mock.Anything, testURL).Return(nil).Once()
+
+		req, _ := http.NewRequest(http.MethodDelete, "/v1/urls/abcxyz", nil)
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNoContent, rr.Code)
+		mockStore.AssertExpectations(t)
+		mockCacheStore.AssertExpectations(t)
+	})
+
+	t.Run("should return 403 when deleting another owner's URL", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		otherURL := *testURL
+		otherURL.OwnerID = testAPIKeyOwner.ID + 1
+		mockCacheStore.On("GetByShortURL", mock.Anything, "", testURL.ShortURL).Return(&otherURL, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodDelete, "/v1/urls/abcxyz", nil)
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+		mockStore.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	})
+}
+
+func TestShorternURLsBatch(t *testing.T) {
+	app := newTestApplication(t, config{redisCfg: redisConfig{enable: true}})
+	mux := app.mount()
+
+	existingLongURL := "https://google.com/"
+	newLongURL := "https://github.com/"
+
+	t.Run("should return a result per URL and create new ones in one call", func(t *testing.T) {
+		resetMocks(app)
+		mockStore := app.store.URL.(*store.MockURLStore)
+		mockCacheStore := app.cacheStorage.URL.(*cache.MockURLStore)
+
+		existingURL := &store.URL{ID: 1, LongURL: existingLongURL, ShortURL: "abcxyz"}
+		onlyNewURL := mock.MatchedBy(func(urls []*store.URL) bool {
+			return len(urls) == 1 && urls[0].LongURL == newLongURL && urls[0].ShortURL != ""
+		})
+
+		mockCacheStore.On("GetByLongURLHash", mock.Anything, testAPIKeyOwner.ID, "", store.ComputeHash(existingLongURL)).Return(existingURL, nil).Once()
+		mockCacheStore.On("GetByLongURLHash", mock.Anything, testAPIKeyOwner.ID, "", store.ComputeHash(newLongURL)).Return(nil, nil).Once()
+		mockStore.On("GetByLongURL", mock.Anything, testAPIKeyOwner.ID, "", newLongURL).Return(nil, store.ErrNotFound).Once()
+		mockStore.On("CreateMany", mock.Anything, onlyNewURL).Return(nil).Once()
+		mockCacheStore.On("SetMany", mock.Anything, onlyNewURL).Return(nil).Once()
+
+		body, _ := json.Marshal(ShorternURLsBatchPayload{
+			LongURLs: []string{existingLongURL, "aaa", newLongURL, newLongURL},
+		})
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten/batch", bytes.NewBuffer(body))
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var res struct {
+			Data []BatchShortenResult `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []string{batchStatusExisting, batchStatusInvalid, batchStatusCreated, batchStatusExisting}
+		if len(res.Data) != len(expected) {
+			t.Fatalf("expected %d results, got %d", len(expected), len(res.Data))
+		}
+		for i, status := range expected {
+			if res.Data[i].Status != status {
+				t.Errorf("result %d: expected status %s, got %s", i, status, res.Data[i].Status)
+			}
+		}
+		if res.Data[2].URL.ShortURL != res.Data[3].URL.ShortURL {
+			t.Errorf("expected duplicate URLs in batch to share a short URL")
+		}
+
+		mockStore.AssertExpectations(t)
+		mockCacheStore.AssertExpectations(t)
+	})
+
+	t.Run("should return 400 if the batch is empty", func(t *testing.T) {
+		resetMocks(app)
+
+		body, _ := json.Marshal(ShorternURLsBatchPayload{LongURLs: []string{}})
+		req, _ := http.NewRequest(http.MethodPost, "/v1/urls/shorten/batch", bytes.NewBuffer(body))
+		authorize(app, req)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
 }
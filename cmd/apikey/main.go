@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/huynguyenanh2000/url-shorterner/internal/db"
+	"github.com/huynguyenanh2000/url-shorterner/internal/env"
+	"github.com/huynguyenanh2000/url-shorterner/internal/pkg/canonical"
+	"github.com/huynguyenanh2000/url-shorterner/internal/store"
+)
+
+// Creates a new API key and prints it. Only the key hash is stored, so the
+// key cannot be shown again.
+func main() {
+	name := flag.String("name", "", "name of the API key owner")
+	flag.Parse()
+
+	if *name == "" {
+		log.Fatal("-name is required")
+	}
+
+	addr := env.GetString("DB_ADDR", "admin:adminpassword@tcp(localhost:3306)/url_shorterner?parseTime=true")
+	conn, err := db.New(addr, 3, 3, "15m")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	store := store.NewStorage(conn, canonical.New(canonical.Options{}), nil)
+
+	key, err := storeAPIKey(store, *name)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(key)
+}
+
+func storeAPIKey(st store.Storage, name string) (string, error) {
+	key, err := store.GenerateAPIKey()
+	if err != nil {
+		return "", err
+	}
+
+	apiKey := &store.APIKey{
+		Name:    name,
+		KeyHash: store.HashAPIKey(key),
+	}
+
+	if err := st.APIKeys.Create(context.Background(), apiKey); err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/huynguyenanh2000/url-shorterner/internal/db"
+	"github.com/huynguyenanh2000/url-shorterner/internal/env"
+	"github.com/huynguyenanh2000/url-shorterner/internal/pkg/canonical"
+	"github.com/huynguyenanh2000/url-shorterner/internal/store"
+	"github.com/huynguyenanh2000/url-shorterner/internal/store/cache"
+)
+
+const backfillPageSize = 500
+
+// Rewrites the long URL of every stored link to its canonical form and
+// rehashes it, so that links created before canonicalization are found when
+// shortening the same long URL again. It must run with the CANONICAL_*
+// settings of the API, and again whenever they change.
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only print the links that would be rewritten")
+	flag.Parse()
+
+	canon := canonical.New(canonical.Options{
+		SortQuery:      env.GetBool("CANONICAL_SORT_QUERY", false),
+		StripTracking:  env.GetBool("CANONICAL_STRIP_TRACKING", false),
+		TrackingParams: env.GetList("CANONICAL_TRACKING_PARAMS", strings.Join(canonical.DefaultTrackingParams, ",")),
+	})
+
+	addr := env.GetString("DB_ADDR", "admin:adminpassword@tcp(localhost:3306)/url_shorterner?parseTime=true")
+	conn, err := db.New(addr, 3, 3, "15m")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	// Cached links hold the long URL as it was. An in-process cache of the
+	// API picks the new one up once its entries expire.
+	cacheStorage := cache.NewNopStorage()
+	if env.GetBool("REDIS_ENABLE", true) {
+		rdb, err := cache.NewRedisClient(
+			env.GetString("REDIS_ADDR", "localhost:6379"),
+			env.GetString("REDIS_PW", ""),
+			env.GetInt("REDIS_DB", 0),
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer rdb.Close()
+
+		cacheStorage = cache.NewRedisStorage(rdb, 0)
+	}
+
+	rewritten, err := backfill(context.Background(), store.NewStorage(conn, canon, nil), cacheStorage, canon, *dryRun)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("%d links rewritten", rewritten)
+}
+
+func backfill(ctx context.Context, st store.Storage, cacheStorage cache.Storage, canon *canonical.Canonicalizer, dryRun bool) (int, error) {
+	var (
+		cursor    uint64
+		rewritten int
+	)
+	for {
+		urls, err := st.URL.ListAll(ctx, cursor, backfillPageSize)
+		if err != nil {
+			return rewritten, err
+		}
+
+		for _, url := range urls {
+			longURL, err := canon.URL(url.LongURL)
+			if err != nil {
+				log.Printf("failed to canonicalize %s: %v", url.ShortURL, err)
+				continue
+			}
+			if longURL == url.LongURL {
+				continue
+			}
+
+			log.Printf("%s: %s -> %s", url.ShortURL, url.LongURL, longURL)
+			if dryRun {
+				rewritten++
+				continue
+			}
+
+			// Update canonicalizes the long URL and rehashes it
+			updated := *url
+			err = st.URL.Update(ctx, &updated)
+			if errors.Is(err, store.ErrDuplicateLongURL) {
+				// The owner already has a link for the canonical long URL,
+				// which is the one deduplication returns from now on
+				log.Printf("%s duplicates another link of owner %d, left as is", url.ShortURL, url.OwnerID)
+				continue
+			}
+			if err != nil {
+				return rewritten, err
+			}
+
+			rewritten++
+			if err := cacheStorage.URL.Delete(ctx, url); err != nil {
+				log.Printf("failed to invalidate cache of %s: %v", url.ShortURL, err)
+			}
+		}
+
+		if len(urls) < backfillPageSize {
+			return rewritten, nil
+		}
+		cursor = urls[len(urls)-1].ID
+	}
+}
@@ -0,0 +1,3 @@
+-- +migrate Up
+ALTER TABLE url
+ADD COLUMN is_custom BOOLEAN NOT NULL DEFAULT FALSE AFTER long_url;
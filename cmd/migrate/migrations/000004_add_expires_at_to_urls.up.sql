@@ -0,0 +1,3 @@
+-- +migrate Up
+ALTER TABLE url
+ADD COLUMN expires_at TIMESTAMP NULL DEFAULT NULL AFTER is_custom;
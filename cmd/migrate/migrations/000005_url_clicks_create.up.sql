@@ -0,0 +1,17 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS url_clicks (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+
+    url_id BIGINT UNSIGNED NOT NULL,
+    short_url VARCHAR(11) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL,
+
+    referrer VARCHAR(2048) NOT NULL DEFAULT '',
+    user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+
+    clicked_at TIMESTAMP NOT NULL,
+
+    PRIMARY KEY (id),
+
+    INDEX idx_url_id_clicked_at (url_id, clicked_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,3 @@
+-- +migrate Down
+DROP INDEX idx_owner_id ON url;
+ALTER TABLE url DROP COLUMN owner_id;
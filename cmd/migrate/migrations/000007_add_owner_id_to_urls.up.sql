@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE url
+ADD COLUMN owner_id BIGINT UNSIGNED NOT NULL DEFAULT 0 AFTER id;
+
+CREATE INDEX idx_owner_id ON url(owner_id, id);
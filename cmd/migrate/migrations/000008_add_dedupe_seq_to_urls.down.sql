@@ -0,0 +1,3 @@
+-- +migrate Down
+DROP INDEX idx_long_url_dedupe ON url;
+ALTER TABLE url DROP COLUMN dedupe_seq;
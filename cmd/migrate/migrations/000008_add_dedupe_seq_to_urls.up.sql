@@ -0,0 +1,16 @@
+-- +migrate Up
+-- dedupe_seq is NULL for links that are never deduplicated (aliases,
+-- expiring links). Otherwise it numbers the distinct long URLs of an owner
+-- sharing the same SHA-1 hash, so hash collisions do not block inserts.
+ALTER TABLE url
+ADD COLUMN dedupe_seq SMALLINT UNSIGNED NULL DEFAULT NULL AFTER long_url_hash;
+
+UPDATE url u
+JOIN (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY owner_id, long_url_hash ORDER BY id) - 1 AS seq
+    FROM url
+    WHERE is_custom = FALSE AND expires_at IS NULL
+) d ON d.id = u.id
+SET u.dedupe_seq = d.seq;
+
+CREATE UNIQUE INDEX idx_long_url_dedupe ON url(owner_id, long_url_hash, dedupe_seq);
@@ -0,0 +1,2 @@
+-- +migrate Down
+ALTER TABLE url DROP COLUMN redirect_type;
@@ -0,0 +1,4 @@
+-- +migrate Up
+-- redirect_type is the HTTP status used to redirect, 0 uses the service default
+ALTER TABLE url
+ADD COLUMN redirect_type SMALLINT UNSIGNED NOT NULL DEFAULT 0 AFTER expires_at;
@@ -0,0 +1,4 @@
+-- +migrate Up
+-- password_hash is the bcrypt hash of the password gating the link, empty for public links
+ALTER TABLE url
+ADD COLUMN password_hash VARCHAR(60) NOT NULL DEFAULT '' AFTER redirect_type;
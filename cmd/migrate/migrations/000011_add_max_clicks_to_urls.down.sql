@@ -0,0 +1,4 @@
+-- +migrate Down
+ALTER TABLE url
+DROP COLUMN click_count,
+DROP COLUMN max_clicks;
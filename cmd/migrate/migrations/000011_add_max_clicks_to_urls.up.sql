@@ -0,0 +1,6 @@
+-- +migrate Up
+-- max_clicks is the number of redirects allowed, NULL for unlimited links.
+-- click_count is the number of redirects consumed against it.
+ALTER TABLE url
+ADD COLUMN max_clicks INT UNSIGNED NULL AFTER password_hash,
+ADD COLUMN click_count INT UNSIGNED NOT NULL DEFAULT 0 AFTER max_clicks;
@@ -0,0 +1,5 @@
+-- +migrate Up
+-- flagged_reason is why the destination was found unsafe after the link was
+-- created, empty for links that are not flagged
+ALTER TABLE url
+ADD COLUMN flagged_reason VARCHAR(255) NOT NULL DEFAULT '' AFTER max_clicks;
@@ -0,0 +1,8 @@
+-- +migrate Down
+DROP INDEX idx_long_url_dedupe ON url;
+CREATE UNIQUE INDEX idx_long_url_dedupe ON url(owner_id, long_url_hash, dedupe_seq);
+
+CREATE UNIQUE INDEX idx_short_url ON url(short_url);
+DROP INDEX idx_domain_short_url ON url;
+
+ALTER TABLE url DROP COLUMN domain;
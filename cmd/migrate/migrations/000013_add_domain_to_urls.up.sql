@@ -0,0 +1,12 @@
+-- +migrate Up
+-- domain is empty for links served from the default domain, otherwise the
+-- branded domain serving them. Short URLs and deduplication are scoped to a
+-- domain.
+ALTER TABLE url
+ADD COLUMN domain VARCHAR(253) CHARACTER SET ascii COLLATE ascii_general_ci NOT NULL DEFAULT '' AFTER owner_id;
+
+CREATE UNIQUE INDEX idx_domain_short_url ON url(domain, short_url);
+DROP INDEX idx_short_url ON url;
+
+DROP INDEX idx_long_url_dedupe ON url;
+CREATE UNIQUE INDEX idx_long_url_dedupe ON url(owner_id, domain, long_url_hash, dedupe_seq);
@@ -0,0 +1,7 @@
+-- +migrate Down
+-- Fails while any short code is longer than 11 characters.
+ALTER TABLE url_clicks
+MODIFY COLUMN short_url VARCHAR(11) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL;
+
+ALTER TABLE url
+MODIFY COLUMN short_url VARCHAR(11) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL;
@@ -0,0 +1,8 @@
+-- +migrate Up
+-- Short codes may be up to 16 characters long, for alphabets smaller than
+-- base62 and padded codes.
+ALTER TABLE url
+MODIFY COLUMN short_url VARCHAR(16) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL;
+
+ALTER TABLE url_clicks
+MODIFY COLUMN short_url VARCHAR(16) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL;
@@ -6,6 +6,7 @@ import (
 	"github.com/huynguyenanh2000/url-shorterner/internal/db"
 	"github.com/huynguyenanh2000/url-shorterner/internal/env"
 	"github.com/huynguyenanh2000/url-shorterner/internal/idgen"
+	"github.com/huynguyenanh2000/url-shorterner/internal/pkg/canonical"
 	"github.com/huynguyenanh2000/url-shorterner/internal/store"
 )
 
@@ -18,7 +19,7 @@ func main() {
 
 	defer conn.Close()
 
-	store := store.NewStorage(conn)
+	store := store.NewStorage(conn, canonical.New(canonical.Options{}), nil)
 
 	machineID := env.GetInt("MACHINE_ID", 1)
 
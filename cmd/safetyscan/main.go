@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/huynguyenanh2000/url-shorterner/internal/db"
+	"github.com/huynguyenanh2000/url-shorterner/internal/env"
+	"github.com/huynguyenanh2000/url-shorterner/internal/pkg/canonical"
+	"github.com/huynguyenanh2000/url-shorterner/internal/safety"
+	"github.com/huynguyenanh2000/url-shorterner/internal/store"
+	"github.com/huynguyenanh2000/url-shorterner/internal/store/cache"
+)
+
+const scanPageSize = 500
+
+// Runs every stored link through the safety checks again, flagging links
+// whose destination became unsafe and clearing the flag of the others.
+// Flagged links serve a warning page instead of redirecting.
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only print the links whose flag would change")
+	flag.Parse()
+
+	lookupTimeout, err := time.ParseDuration(env.GetString("SAFETY_LOOKUP_TIMEOUT", "2s"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	checker, err := safety.New(safety.Config{
+		BlocklistFile: env.GetString("SAFETY_BLOCKLIST_FILE", ""),
+		DenylistFile:  env.GetString("SAFETY_DENYLIST_FILE", ""),
+		LookupURL:     env.GetString("SAFETY_LOOKUP_URL", ""),
+		LookupTimeout: lookupTimeout,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	addr := env.GetString("DB_ADDR", "admin:adminpassword@tcp(localhost:3306)/url_shorterner?parseTime=true")
+	conn, err := db.New(addr, 3, 3, "15m")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	// Flag changes must reach the API through the shared cache. An
+	// in-process cache of the API picks them up once its entries expire.
+	cacheStorage := cache.NewNopStorage()
+	if env.GetBool("REDIS_ENABLE", true) {
+		rdb, err := cache.NewRedisClient(
+			env.GetString("REDIS_ADDR", "localhost:6379"),
+			env.GetString("REDIS_PW", ""),
+			env.GetInt("REDIS_DB", 0),
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer rdb.Close()
+
+		cacheStorage = cache.NewRedisStorage(rdb, 0)
+	}
+
+	changed, err := scan(context.Background(), store.NewStorage(conn, canonical.New(canonical.Options{}), nil), cacheStorage, checker, *dryRun)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("%d links changed", changed)
+}
+
+func scan(ctx context.Context, st store.Storage, cacheStorage cache.Storage, checker safety.Checker, dryRun bool) (int, error) {
+	var (
+		cursor  uint64
+		changed int
+	)
+	for {
+		urls, err := st.URL.ListAll(ctx, cursor, scanPageSize)
+		if err != nil {
+			return changed, err
+		}
+
+		for _, url := range urls {
+			verdict, err := checker.Check(ctx, url.LongURL)
+			if err != nil {
+				// Keep the current flag of links that could not be checked
+				log.Printf("failed to check %s: %v", url.ShortURL, err)
+				continue
+			}
+
+			reason := ""
+			if verdict.Blocked {
+				reason = verdict.Reason
+			}
+			if reason == url.FlaggedReason {
+				continue
+			}
+
+			changed++
+			log.Printf("%s -> %s: flag %q -> %q", url.ShortURL, url.LongURL, url.FlaggedReason, reason)
+			if dryRun {
+				continue
+			}
+
+			if err := st.URL.Flag(ctx, url.ID, reason); err != nil {
+				return changed, err
+			}
+			if err := cacheStorage.URL.Delete(ctx, url); err != nil {
+				log.Printf("failed to invalidate cache of %s: %v", url.ShortURL, err)
+			}
+		}
+
+		if len(urls) < scanPageSize {
+			return changed, nil
+		}
+		cursor = urls[len(urls)-1].ID
+	}
+}
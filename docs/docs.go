@@ -24,13 +24,63 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/urls/shorten": {
-            "post": {
+        "/urls": {
+            "get": {
+                "description": "List the URLs owned by the caller, newest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "urls"
+                ],
+                "summary": "List URLs",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 20, max 100)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.ListURLsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {}
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {}
+                    },
+                    "429": {
+                        "description": "Rate limit exceeded",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {}
+                    }
+                },
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
-                ],
+                ]
+            }
+        },
+        "/urls/shorten": {
+            "post": {
                 "description": "Shortern an URL",
                 "consumes": [
                     "application/json"
@@ -57,22 +107,103 @@ const docTemplate = `{
                     "201": {
                         "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/store.URL"
+                            "$ref": "#/definitions/main.URLResponse"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "Short link of the new URL"
+                            }
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "Invalid payload or unknown domain",
                         "schema": {}
                     },
                     "401": {
                         "description": "Unauthorized",
                         "schema": {}
                     },
+                    "409": {
+                        "description": "Alias already in use",
+                        "schema": {}
+                    },
+                    "422": {
+                        "description": "Long URL is blocked by safety checks, points at another shortener or at a short link that cannot be followed",
+                        "schema": {}
+                    },
+                    "429": {
+                        "description": "Rate limit exceeded",
+                        "schema": {}
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {}
                     }
-                }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/urls/shorten/batch": {
+            "post": {
+                "description": "Shortern up to 100 URLs at once, with a result per URL in the same order. Each URL counts against the rate limit of shortening",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "urls"
+                ],
+                "summary": "Shortern URLs in batch",
+                "parameters": [
+                    {
+                        "description": "URLs payload",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.ShorternURLsBatchPayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.BatchShortenResult"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid payload or unknown domain",
+                        "schema": {}
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {}
+                    },
+                    "429": {
+                        "description": "Rate limit exceeded",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {}
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
             }
         },
         "/urls/{shortURL}": {
@@ -98,6 +229,30 @@ const docTemplate = `{
                     }
                 ],
                 "responses": {
+                    "200": {
+                        "description": "Password form of a password-protected URL, or warning page of a flagged URL",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "301": {
+                        "description": "Moved Permanently",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "302": {
+                        "description": "Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "307": {
+                        "description": "Temporary Redirect",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "308": {
                         "description": "Permanent Redirect",
                         "schema": {
@@ -108,38 +263,533 @@ const docTemplate = `{
                         "description": "URL not found",
                         "schema": {}
                     },
+                    "410": {
+                        "description": "URL has expired or has no clicks left",
+                        "schema": {}
+                    },
+                    "429": {
+                        "description": "Rate limit exceeded",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {}
+                    }
+                }
+            },
+            "post": {
+                "description": "Check the password of a short URL submitted from the password form. On success an unlock cookie is set and the client is sent back to the short URL",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "urls"
+                ],
+                "summary": "Unlock a password-protected short URL",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Short URL",
+                        "name": "shortURL",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Password of the short URL",
+                        "name": "password",
+                        "in": "formData",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "303": {
+                        "description": "Unlocked, redirect to the short URL"
+                    },
+                    "401": {
+                        "description": "Wrong password"
+                    },
+                    "404": {
+                        "description": "URL not found",
+                        "schema": {}
+                    },
+                    "410": {
+                        "description": "URL has expired",
+                        "schema": {}
+                    },
+                    "429": {
+                        "description": "Too many failed attempts"
+                    }
+                }
+            },
+            "delete": {
+                "description": "Delete a short URL",
+                "tags": [
+                    "urls"
+                ],
+                "summary": "Delete URL",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Short URL",
+                        "name": "shortURL",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {}
+                    },
+                    "403": {
+                        "description": "URL is owned by another API key",
+                        "schema": {}
+                    },
+                    "404": {
+                        "description": "URL not found",
+                        "schema": {}
+                    },
+                    "410": {
+                        "description": "URL has expired",
+                        "schema": {}
+                    },
+                    "429": {
+                        "description": "Rate limit exceeded",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {}
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            },
+            "patch": {
+                "description": "Change the long URL a short URL redirects to",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "urls"
+                ],
+                "summary": "Update URL target",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Short URL",
+                        "name": "shortURL",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "URL payload",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.UpdateURLPayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.URLResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {}
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {}
+                    },
+                    "403": {
+                        "description": "URL is owned by another API key",
+                        "schema": {}
+                    },
+                    "404": {
+                        "description": "URL not found",
+                        "schema": {}
+                    },
+                    "409": {
+                        "description": "Another URL already points to the long URL",
+                        "schema": {}
+                    },
+                    "410": {
+                        "description": "URL has expired",
+                        "schema": {}
+                    },
+                    "422": {
+                        "description": "Long URL is blocked by safety checks, points at another shortener or at a short link that cannot be followed",
+                        "schema": {}
+                    },
+                    "429": {
+                        "description": "Rate limit exceeded",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {}
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/urls/{shortURL}/info": {
+            "get": {
+                "description": "Get the metadata of a short URL as JSON instead of redirecting",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "urls"
+                ],
+                "summary": "Get URL metadata",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Short URL",
+                        "name": "shortURL",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.URLResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {}
+                    },
+                    "403": {
+                        "description": "URL is owned by another API key",
+                        "schema": {}
+                    },
+                    "404": {
+                        "description": "URL not found",
+                        "schema": {}
+                    },
+                    "410": {
+                        "description": "URL has expired",
+                        "schema": {}
+                    },
+                    "429": {
+                        "description": "Rate limit exceeded",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {}
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/urls/{shortURL}/qr": {
+            "get": {
+                "description": "Render a QR code encoding the public short URL, as PNG or SVG",
+                "produces": [
+                    "image/png",
+                    "image/svg+xml"
+                ],
+                "tags": [
+                    "urls"
+                ],
+                "summary": "Get the QR code of a short URL",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Short URL",
+                        "name": "shortURL",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Image format: png or svg (default png)",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Width and height in pixels, 64 to 2048 (default 256)",
+                        "name": "size",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Error correction level: L, M, Q or H (default M)",
+                        "name": "level",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Quiet zone in modules, 0 to 16 (default 4)",
+                        "name": "margin",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "QR code image"
+                    },
+                    "304": {
+                        "description": "QR code not modified"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {}
+                    },
+                    "404": {
+                        "description": "URL not found",
+                        "schema": {}
+                    },
+                    "410": {
+                        "description": "URL has expired",
+                        "schema": {}
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {}
                     }
                 }
             }
+        },
+        "/urls/{shortURL}/stats": {
+            "get": {
+                "description": "Get total clicks plus per-day and per-referrer breakdowns of a short URL",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "urls"
+                ],
+                "summary": "Get click stats of a short URL",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Short URL",
+                        "name": "shortURL",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of days in the per-day breakdown (default 30, max 365)",
+                        "name": "days",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.URLStatsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {}
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {}
+                    },
+                    "403": {
+                        "description": "URL is owned by another API key",
+                        "schema": {}
+                    },
+                    "404": {
+                        "description": "URL not found",
+                        "schema": {}
+                    },
+                    "410": {
+                        "description": "URL has expired",
+                        "schema": {}
+                    },
+                    "429": {
+                        "description": "Rate limit exceeded",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {}
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
         }
     },
     "definitions": {
+        "main.BatchShortenResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "long_url": {
+                    "type": "string"
+                },
+                "status": {
+                    "description": "One of created, existing, invalid or blocked",
+                    "type": "string"
+                },
+                "url": {
+                    "$ref": "#/definitions/main.URLResponse"
+                }
+            }
+        },
+        "main.ListURLsResponse": {
+            "type": "object",
+            "properties": {
+                "next_cursor": {
+                    "description": "Cursor of the next page, empty on the last page",
+                    "type": "string"
+                },
+                "urls": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.URLResponse"
+                    }
+                }
+            }
+        },
         "main.ShorternURLPayload": {
             "type": "object",
             "required": [
                 "long_url"
             ],
             "properties": {
+                "alias": {
+                    "type": "string"
+                },
+                "domain": {
+                    "description": "Branded domain serving the link, defaults to the domain of the API",
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
                 "long_url": {
                     "type": "string"
+                },
+                "max_clicks": {
+                    "description": "Number of redirects allowed before the link is gone, 1 for a one-time link",
+                    "type": "integer",
+                    "maximum": 4294967295
+                },
+                "password": {
+                    "description": "Password visitors must enter before being redirected, at most 72 bytes",
+                    "type": "string",
+                    "maxLength": 72,
+                    "minLength": 4
+                },
+                "redirect_type": {
+                    "description": "HTTP status used to redirect, defaults to the service-wide one",
+                    "type": "integer",
+                    "enum": [
+                        301,
+                        302,
+                        307,
+                        308
+                    ]
+                },
+                "ttl_seconds": {
+                    "type": "integer",
+                    "maximum": 315360000
+                }
+            }
+        },
+        "main.ShorternURLsBatchPayload": {
+            "type": "object",
+            "required": [
+                "long_urls"
+            ],
+            "properties": {
+                "domain": {
+                    "description": "Branded domain serving the links, defaults to the domain of the API",
+                    "type": "string"
+                },
+                "long_urls": {
+                    "type": "array",
+                    "maxItems": 100,
+                    "minItems": 1,
+                    "items": {
+                        "type": "string"
+                    }
                 }
             }
         },
-        "store.URL": {
+        "main.URLResponse": {
             "type": "object",
             "properties": {
                 "created_at": {
                     "type": "string"
                 },
+                "domain": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "flagged_reason": {
+                    "type": "string"
+                },
                 "id": {
                     "type": "integer"
                 },
+                "is_custom": {
+                    "type": "boolean"
+                },
+                "link": {
+                    "description": "Short link to share, on the domain of the URL",
+                    "type": "string"
+                },
                 "long_url": {
                     "type": "string"
                 },
+                "max_clicks": {
+                    "type": "integer"
+                },
+                "owner_id": {
+                    "type": "integer"
+                },
+                "redirect_type": {
+                    "type": "integer"
+                },
                 "short_url": {
                     "type": "string"
                 },
@@ -147,6 +797,62 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "main.URLStatsResponse": {
+            "type": "object",
+            "properties": {
+                "by_day": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/store.DailyClicks"
+                    }
+                },
+                "by_referrer": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/store.ReferrerClicks"
+                    }
+                },
+                "short_url": {
+                    "type": "string"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.UpdateURLPayload": {
+            "type": "object",
+            "required": [
+                "long_url"
+            ],
+            "properties": {
+                "long_url": {
+                    "type": "string"
+                }
+            }
+        },
+        "store.DailyClicks": {
+            "type": "object",
+            "properties": {
+                "clicks": {
+                    "type": "integer"
+                },
+                "day": {
+                    "type": "string"
+                }
+            }
+        },
+        "store.ReferrerClicks": {
+            "type": "object",
+            "properties": {
+                "clicks": {
+                    "type": "integer"
+                },
+                "referrer": {
+                    "type": "string"
+                }
+            }
         }
     },
     "securityDefinitions": {
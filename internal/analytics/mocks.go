@@ -0,0 +1,18 @@
+package analytics
+
+import (
+	"github.com/huynguyenanh2000/url-shorterner/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func NewMockRecorder() *MockRecorder {
+	return &MockRecorder{}
+}
+
+type MockRecorder struct {
+	mock.Mock
+}
+
+func (m *MockRecorder) Record(click *store.Click) {
+	m.Called(click)
+}
@@ -0,0 +1,97 @@
+package analytics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/huynguyenanh2000/url-shorterner/internal/store"
+	"go.uber.org/zap"
+)
+
+type Recorder interface {
+	Record(*store.Click)
+}
+
+// BatchRecorder buffers clicks in memory and writes them to the store in
+// batches from a background goroutine, so recording never blocks on MySQL.
+// Clicks are dropped when the buffer is full.
+type BatchRecorder struct {
+	store         store.Storage
+	logger        *zap.SugaredLogger
+	events        chan *store.Click
+	batchSize     int
+	flushInterval time.Duration
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func NewBatchRecorder(st store.Storage, logger *zap.SugaredLogger, bufferSize, batchSize int, flushInterval time.Duration) *BatchRecorder {
+	r := &BatchRecorder{
+		store:         st,
+		logger:        logger,
+		events:        make(chan *store.Click, bufferSize),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		done:          make(chan struct{}),
+	}
+
+	go r.run()
+
+	return r
+}
+
+func (r *BatchRecorder) Record(click *store.Click) {
+	select {
+	case r.events <- click:
+	default:
+		r.logger.Warnw("click buffer is full, dropping click", "short_url", click.ShortURL)
+	}
+}
+
+// Close stops accepting clicks and flushes the ones still buffered. It must
+// only be called once no more clicks are being recorded.
+func (r *BatchRecorder) Close() {
+	r.closeOnce.Do(func() {
+		close(r.events)
+		<-r.done
+	})
+}
+
+func (r *BatchRecorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*store.Click, 0, r.batchSize)
+	for {
+		select {
+		case click, ok := <-r.events:
+			if !ok {
+				r.flush(batch)
+				return
+			}
+
+			batch = append(batch, click)
+			if len(batch) >= r.batchSize {
+				r.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			r.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (r *BatchRecorder) flush(batch []*store.Click) {
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := r.store.Clicks.CreateMany(context.Background(), batch); err != nil {
+		r.logger.Errorw("failed to write clicks", "count", len(batch), "error", err)
+	}
+}
@@ -5,11 +5,15 @@ import (
 	"database/sql"
 	"time"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/go-sql-driver/mysql"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
 )
 
+// New opens a MySQL connection pool whose queries are traced with the global
+// tracer provider.
 func New(addr string, maxOpenConns, maxIdleConns int, maxIdleTime string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", addr)
+	db, err := otelsql.Open("mysql", addr, otelsql.WithAttributes(semconv.DBSystemNameMySQL))
 	if err != nil {
 		return nil, err
 	}
@@ -8,7 +8,7 @@ import (
 	"time"
 
 	"github.com/huynguyenanh2000/url-shorterner/internal/idgen"
-	"github.com/huynguyenanh2000/url-shorterner/internal/pkg/base62"
+	"github.com/huynguyenanh2000/url-shorterner/internal/pkg/alphabet"
 	"github.com/huynguyenanh2000/url-shorterner/internal/store"
 )
 
@@ -35,7 +35,7 @@ func SeedURLs(st store.Storage, db *sql.DB, idGen idgen.Client) {
 			domain, path, i, time.Now().UnixNano())
 
 		id := idGen.Generate()
-		shortCode := base62.Encode(id)
+		shortCode := alphabet.Base62.Encode(id)
 
 		url := &store.URL{
 			ID:        id,
@@ -3,6 +3,7 @@ package env
 import (
 	"os"
 	"strconv"
+	"strings"
 )
 
 func GetString(key, fallback string) string {
@@ -41,3 +42,30 @@ func GetBool(key string, fallback bool) bool {
 
 	return boolVal
 }
+
+func GetFloat(key string, fallback float64) float64 {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	floatVal, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return fallback
+	}
+
+	return floatVal
+}
+
+// GetList splits a comma-separated setting into lowercased, trimmed items.
+func GetList(key, fallback string) []string {
+	var items []string
+	for _, item := range strings.Split(GetString(key, fallback), ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
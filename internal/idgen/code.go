@@ -0,0 +1,251 @@
+package idgen
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/huynguyenanh2000/url-shorterner/internal/pkg/alphabet"
+)
+
+// MaxCodeLength is the longest short code the database holds.
+const MaxCodeLength = 16
+
+// CodeGenerator turns the ID of a new link into its short code. Codes of
+// generators that are not one-to-one may collide with existing ones, in which
+// case the caller draws another.
+type CodeGenerator interface {
+	Code(id uint64) string
+	// Valid reports whether code may have been generated, without any I/O.
+	Valid(code string) bool
+	// Shaped reports whether code has the form of generated codes, whether
+	// or not it may have been generated. Vanity aliases must not, so that
+	// aliases and codes are told apart without any I/O.
+	Shaped(code string) bool
+	// Possible reports whether code may have been generated by any strategy
+	// over the same alphabet and length, such as one configured before, so
+	// that links outlive a change of strategy.
+	Possible(code string) bool
+	// Decode returns the ID a valid code was generated from, if the generator
+	// can tell.
+	Decode(code string) (uint64, bool)
+}
+
+// SequentialCodes encodes IDs as is. Codes are short but follow the order of
+// the IDs, so neighbouring links are easy to enumerate.
+type SequentialCodes struct {
+	alphabet *alphabet.Alphabet
+	length   int
+	// minLength is the length of the code of the first ID ever issued
+	minLength int
+}
+
+// NewSequentialCodes returns a generator of codes padded to at least length
+// characters.
+func NewSequentialCodes(a *alphabet.Alphabet, length int) (*SequentialCodes, error) {
+	if err := checkPaddedLength(a, length); err != nil {
+		return nil, err
+	}
+
+	return &SequentialCodes{alphabet: a, length: length, minLength: len(a.EncodeLen(minSnowflake(), length))}, nil
+}
+
+func (c *SequentialCodes) Code(id uint64) string {
+	return c.alphabet.EncodeLen(id, c.length)
+}
+
+func (c *SequentialCodes) Valid(code string) bool {
+	_, ok := c.Decode(code)
+	return ok
+}
+
+// Shaped covers every length from that of the code of the first ID issued to
+// that of the largest 64-bit one.
+func (c *SequentialCodes) Shaped(code string) bool {
+	return len(code) >= c.minLength && len(code) <= max(c.length, c.alphabet.MaxLen()) && c.alphabet.Valid(code)
+}
+
+func (c *SequentialCodes) Possible(code string) bool {
+	return possibleCode(c.alphabet, c.length, code)
+}
+
+func (c *SequentialCodes) Decode(code string) (uint64, bool) {
+	id, ok := decodeCanonical(c.alphabet, c.length, code)
+	if !ok || !ValidSnowflake(id) {
+		return 0, false
+	}
+
+	return id, true
+}
+
+// RandomCodes draws codes of a fixed length uniformly at random, ignoring
+// the ID. With base^length codes, collisions only become likely once the
+// number of links nears the square root of that.
+type RandomCodes struct {
+	alphabet *alphabet.Alphabet
+	length   int
+}
+
+func NewRandomCodes(a *alphabet.Alphabet, length int) (*RandomCodes, error) {
+	if length < 1 || length > MaxCodeLength {
+		return nil, fmt.Errorf("random code length must be between 1 and %d", MaxCodeLength)
+	}
+
+	return &RandomCodes{alphabet: a, length: length}, nil
+}
+
+func (c *RandomCodes) Code(uint64) string {
+	return c.alphabet.Random(c.length)
+}
+
+func (c *RandomCodes) Valid(code string) bool {
+	return len(code) == c.length && c.alphabet.Valid(code)
+}
+
+func (c *RandomCodes) Shaped(code string) bool {
+	return c.Valid(code)
+}
+
+func (c *RandomCodes) Possible(code string) bool {
+	return possibleCode(c.alphabet, c.length, code)
+}
+
+// Decode never tells the ID, which random codes are unrelated to.
+func (c *RandomCodes) Decode(string) (uint64, bool) {
+	return 0, false
+}
+
+// feistelRounds is enough rounds for the permutation to be
+// indistinguishable from a random one to anyone without the key.
+const feistelRounds = 4
+
+// FeistelCodes encodes IDs permuted by a Feistel network keyed by a secret.
+// The permutation is one-to-one, so codes never collide, yet neighbouring IDs
+// get unrelated codes.
+type FeistelCodes struct {
+	alphabet *alphabet.Alphabet
+	length   int
+	key      []byte
+}
+
+// NewFeistelCodes returns a generator of codes padded to at least length
+// characters. Permuted IDs span 64 bits, so codes are rarely shorter than
+// the longest encoding in the alphabet anyway.
+func NewFeistelCodes(a *alphabet.Alphabet, length int, secret string) (*FeistelCodes, error) {
+	if len(secret) < 16 {
+		return nil, errors.New("feistel code secret must be at least 16 bytes")
+	}
+	if err := checkPaddedLength(a, length); err != nil {
+		return nil, err
+	}
+
+	return &FeistelCodes{alphabet: a, length: length, key: []byte(secret)}, nil
+}
+
+func (c *FeistelCodes) Code(id uint64) string {
+	return c.alphabet.EncodeLen(c.permute(id), c.length)
+}
+
+func (c *FeistelCodes) Valid(code string) bool {
+	_, ok := c.Decode(code)
+	return ok
+}
+
+// Shaped covers codes of the full length, which most permuted IDs have, and
+// the valid shorter ones.
+func (c *FeistelCodes) Shaped(code string) bool {
+	return c.Valid(code) || paddedShaped(c.alphabet, c.length, code)
+}
+
+func (c *FeistelCodes) Possible(code string) bool {
+	return possibleCode(c.alphabet, c.length, code)
+}
+
+func (c *FeistelCodes) Decode(code string) (uint64, bool) {
+	v, ok := decodeCanonical(c.alphabet, c.length, code)
+	if !ok {
+		return 0, false
+	}
+
+	id := c.unpermute(v)
+	if !ValidSnowflake(id) {
+		return 0, false
+	}
+
+	return id, true
+}
+
+// permute runs id through a balanced Feistel network over its two 32-bit
+// halves.
+func (c *FeistelCodes) permute(id uint64) uint64 {
+	left, right := uint32(id>>32), uint32(id)
+	for round := range feistelRounds {
+		left, right = right, left^c.round(round, right)
+	}
+
+	return uint64(left)<<32 | uint64(right)
+}
+
+// unpermute is the inverse of permute.
+func (c *FeistelCodes) unpermute(v uint64) uint64 {
+	left, right := uint32(v>>32), uint32(v)
+	for round := feistelRounds - 1; round >= 0; round-- {
+		left, right = right^c.round(round, left), left
+	}
+
+	return uint64(left)<<32 | uint64(right)
+}
+
+// round is the round function, a keyed hash of the round number and half.
+func (c *FeistelCodes) round(round int, half uint32) uint32 {
+	var msg [5]byte
+	msg[0] = byte(round)
+	binary.BigEndian.PutUint32(msg[1:], half)
+
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write(msg[:])
+	return binary.BigEndian.Uint32(mac.Sum(nil))
+}
+
+// decodeCanonical decodes code if it is the very code of its value padded to
+// length, rejecting other spellings such as extra padding.
+func decodeCanonical(a *alphabet.Alphabet, length int, code string) (uint64, bool) {
+	if len(code) > max(length, a.MaxLen()) {
+		return 0, false
+	}
+
+	v, err := a.Decode(code)
+	if err != nil || a.EncodeLen(v, length) != code {
+		return 0, false
+	}
+
+	return v, true
+}
+
+// possibleCode reports whether code encodes a 64-bit number padded to length,
+// as sequential and feistel codes do, or is as long as random codes.
+func possibleCode(a *alphabet.Alphabet, length int, code string) bool {
+	if _, ok := decodeCanonical(a, length, code); ok {
+		return true
+	}
+
+	return len(code) == length && a.Valid(code)
+}
+
+// paddedShaped reports whether code is as long as the longest codes padded
+// to length and made of characters of the alphabet.
+func paddedShaped(a *alphabet.Alphabet, length int, code string) bool {
+	return len(code) == max(length, a.MaxLen()) && a.Valid(code)
+}
+
+// checkPaddedLength checks that codes encoding a 64-bit number padded to
+// length fit the database.
+func checkPaddedLength(a *alphabet.Alphabet, length int) error {
+	if max(length, a.MaxLen()) > MaxCodeLength {
+		return fmt.Errorf("codes of %d characters in base %d exceed the maximum of %d", max(length, a.MaxLen()), a.Base(), MaxCodeLength)
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package idgen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/huynguyenanh2000/url-shorterner/internal/pkg/alphabet"
+)
+
+func TestFeistelCodes(t *testing.T) {
+	codes, err := NewFeistelCodes(alphabet.Base62, 0, "0123456789abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := NewFeistelCodes(alphabet.Base62, 0, "fedcba9876543210")
+
+	seen := make(map[string]bool)
+	for id := uint64(1 << 40); id < 1<<40+1000; id++ {
+		code := codes.Code(id)
+		if seen[code] {
+			t.Fatalf("code %q of id %d collides", code, id)
+		}
+		seen[code] = true
+
+		if codes.Code(id) != code {
+			t.Fatalf("expected the code of id %d to be stable", id)
+		}
+		if other.Code(id) == code {
+			t.Fatalf("expected the code of id %d to depend on the secret", id)
+		}
+		if len(code) > 11 {
+			t.Fatalf("expected codes of at most 11 characters, got %q", code)
+		}
+	}
+
+	if _, err := NewFeistelCodes(alphabet.Base62, 0, "short"); err == nil {
+		t.Error("expected short secrets to be rejected")
+	}
+	if _, err := NewFeistelCodes(alphabet.Base62, MaxCodeLength+1, "0123456789abcdef"); err == nil {
+		t.Error("expected codes longer than the column to be rejected")
+	}
+}
+
+func TestRandomCodes(t *testing.T) {
+	codes, err := NewRandomCodes(alphabet.Base58, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[string]bool)
+	for range 1000 {
+		code := codes.Code(0)
+		if len(code) != 8 || strings.ContainsAny(code, "0OIl") {
+			t.Fatalf("expected 8 base58 characters, got %q", code)
+		}
+		seen[code] = true
+	}
+	if len(seen) < 1000 {
+		t.Errorf("expected 1000 distinct codes, got %d", len(seen))
+	}
+
+	if _, err := NewRandomCodes(alphabet.Base58, 0); err == nil {
+		t.Error("expected a zero length to be rejected")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	sequential, _ := NewSequentialCodes(alphabet.Base36, 0)
+	feistel, _ := NewFeistelCodes(alphabet.Base58, 0, "0123456789abcdef")
+	random, _ := NewRandomCodes(alphabet.Base62, 8)
+
+	snowflake, err := NewSnowflakeClient(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := snowflake.Generate()
+
+	for _, codes := range []CodeGenerator{sequential, feistel} {
+		code := codes.Code(id)
+		if got, ok := codes.Decode(code); !ok || got != id {
+			t.Errorf("expected %q to decode to %d, got %d, %v", code, id, got, ok)
+		}
+
+		for _, invalid := range []string{"", "0" + code, code + "0", "abc", "OIl0", strings.Repeat("z", MaxCodeLength+1)} {
+			if codes.Valid(invalid) {
+				t.Errorf("expected %q to be invalid", invalid)
+			}
+		}
+
+		if !codes.Shaped(code) {
+			t.Errorf("expected %q to be shaped like a code", code)
+		}
+		if codes.Shaped("spring-sale") || codes.Shaped("abc") {
+			t.Errorf("expected aliases not to be shaped like codes")
+		}
+	}
+
+	// Too far in the future for an ID, yet of the length of codes
+	for codes, outOfRange := range map[CodeGenerator]string{sequential: "zzzzzzzzzzzz", feistel: "zzzzzzzzzzz"} {
+		if codes.Valid(outOfRange) || !codes.Shaped(outOfRange) {
+			t.Errorf("expected %q to be shaped like a code but invalid", outOfRange)
+		}
+	}
+
+	code := random.Code(id)
+	if _, ok := random.Decode(code); ok || !random.Valid(code) || random.Valid(code[1:]) || random.Shaped(code[1:]) {
+		t.Errorf("expected random codes to be valid only at full length and never decoded")
+	}
+}
+
+func TestPossible(t *testing.T) {
+	sequential, _ := NewSequentialCodes(alphabet.Base62, 0)
+	feistel, _ := NewFeistelCodes(alphabet.Base62, 0, "0123456789abcdef")
+
+	snowflake, err := NewSnowflakeClient(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := snowflake.Generate()
+
+	// Links created before a change of strategy keep their codes
+	for _, codes := range []CodeGenerator{sequential, feistel} {
+		for _, code := range []string{sequential.Code(id), feistel.Code(id), alphabet.Base62.Encode(1<<64 - 1)} {
+			if !codes.Possible(code) {
+				t.Errorf("expected %q to be possible", code)
+			}
+		}
+
+		// Past the largest 64-bit number, or padded beyond length
+		for _, impossible := range []string{"zzzzzzzzzzz", "0" + sequential.Code(id)} {
+			if codes.Possible(impossible) {
+				t.Errorf("expected %q to be impossible", impossible)
+			}
+		}
+	}
+}
@@ -1,6 +1,17 @@
 package idgen
 
-import "github.com/bwmarrin/snowflake"
+import (
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+)
+
+// snowflakeFloor predates every ID the service has issued.
+var snowflakeFloor = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// maxClockSkew is how far ahead of the local clock another replica may issue
+// IDs.
+const maxClockSkew = time.Minute
 
 type SnowflakeIDGenerator struct {
 	node *snowflake.Node
@@ -20,3 +31,19 @@ func NewSnowflakeClient(machineID int64) (*SnowflakeIDGenerator, error) {
 func (s *SnowflakeIDGenerator) Generate() uint64 {
 	return uint64(s.node.Generate().Int64())
 }
+
+// ValidSnowflake reports whether id may have been issued by the service, i.e.
+// whether its timestamp lies between the first release and now.
+func ValidSnowflake(id uint64) bool {
+	if id > 1<<63-1 {
+		return false
+	}
+
+	issued := time.UnixMilli(int64(id>>(snowflake.NodeBits+snowflake.StepBits)) + snowflake.Epoch)
+	return !issued.Before(snowflakeFloor) && !issued.After(time.Now().Add(maxClockSkew))
+}
+
+// minSnowflake returns the first ID the service may have issued.
+func minSnowflake() uint64 {
+	return uint64(snowflakeFloor.UnixMilli()-snowflake.Epoch) << (snowflake.NodeBits + snowflake.StepBits)
+}
@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/huynguyenanh2000/url-shorterner/internal/idgen"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "url_shorterner"
+
+// Metrics holds the Prometheus metrics of the service, on a registry of its
+// own.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	cacheLookups    *prometheus.CounterVec
+	queryDuration   *prometheus.HistogramVec
+	idsGenerated    prometheus.Counter
+}
+
+// New registers the metrics of the service, along with the Go runtime and
+// process metrics. The connection pool gauges of db are reported if db is
+// not nil.
+func New(db *sql.DB) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latencies by method and route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_lookups_total",
+			Help:      "URL cache lookups by operation and result (hit or miss).",
+		}, []string{"op", "result"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "Database query latencies of the URL store by operation.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"op"}),
+		idsGenerated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "snowflake_ids_generated_total",
+			Help:      "Snowflake IDs generated.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.cacheLookups,
+		m.queryDuration,
+		m.idsGenerated,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if db != nil {
+		m.registry.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+	}
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware counts requests and observes their latency, labeled with the
+// chi route pattern rather than the path so that short codes do not each
+// get their own series.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		m.requests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		m.requestDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// CacheLookup counts a lookup of the URL cache by op.
+func (m *Metrics) CacheLookup(op string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+
+	m.cacheLookups.WithLabelValues(op, result).Inc()
+}
+
+// ObserveQuery records the duration of a query of the URL store.
+func (m *Metrics) ObserveQuery(op string, d time.Duration) {
+	m.queryDuration.WithLabelValues(op).Observe(d.Seconds())
+}
+
+// InstrumentIDGenerator counts the IDs generated by c.
+func (m *Metrics) InstrumentIDGenerator(c idgen.Client) idgen.Client {
+	return &countingIDGenerator{Client: c, generated: m.idsGenerated}
+}
+
+type countingIDGenerator struct {
+	idgen.Client
+	generated prometheus.Counter
+}
+
+func (g *countingIDGenerator) Generate() uint64 {
+	g.generated.Inc()
+	return g.Client.Generate()
+}
@@ -0,0 +1,175 @@
+package alphabet
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	ErrInvalidChar = errors.New("character is not in the alphabet")
+	ErrOverflow    = errors.New("value does not fit in 64 bits")
+)
+
+var (
+	// Base62 is the default alphabet, digits and both cases of letters.
+	Base62 = MustNew("0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	// Base58 leaves out 0, O, I and l, which are easily mistaken for one
+	// another when printed or read aloud.
+	Base58 = MustNew("123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz")
+	// Base36 is digits and lowercase letters only, for links typed on phones.
+	Base36 = MustNew("0123456789abcdefghijklmnopqrstuvwxyz")
+)
+
+// Alphabet encodes numbers as strings of its characters, most significant
+// first.
+type Alphabet struct {
+	chars string
+	// index maps a byte to its value plus one, 0 if not in the alphabet
+	index  [256]uint8
+	maxLen int
+}
+
+// New returns the alphabet of chars, which must be at least 2 distinct
+// characters that are left as is in a URL path: letters, digits, '-', '_'
+// and '~'. The '.' is left out too, as "." and ".." are path segments of their
+// own.
+func New(chars string) (*Alphabet, error) {
+	if len(chars) < 2 || len(chars) > 255 {
+		return nil, errors.New("alphabet must have between 2 and 255 characters")
+	}
+
+	a := &Alphabet{chars: chars}
+	for i := range len(chars) {
+		c := chars[i]
+		if !urlSafe(c) {
+			return nil, fmt.Errorf("alphabet character %q is not a letter, digit, '-', '_' or '~'", c)
+		}
+		if a.index[c] != 0 {
+			return nil, fmt.Errorf("alphabet character %q is repeated", c)
+		}
+		a.index[c] = uint8(i + 1)
+	}
+	a.maxLen = len(a.Encode(math.MaxUint64))
+
+	return a, nil
+}
+
+func urlSafe(c byte) bool {
+	switch {
+	case c >= '0' && c <= '9', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		return true
+	}
+
+	return c == '-' || c == '_' || c == '~'
+}
+
+func MustNew(chars string) *Alphabet {
+	a, err := New(chars)
+	if err != nil {
+		panic(err)
+	}
+
+	return a
+}
+
+// Named returns one of the predefined alphabets by name, or the alphabet of
+// the given characters.
+func Named(name string) (*Alphabet, error) {
+	switch name {
+	case "base62":
+		return Base62, nil
+	case "base58":
+		return Base58, nil
+	case "base36":
+		return Base36, nil
+	default:
+		return New(name)
+	}
+}
+
+// Base returns the number of characters of the alphabet.
+func (a *Alphabet) Base() int {
+	return len(a.chars)
+}
+
+// MaxLen returns the length of the longest encoding of a 64-bit number.
+func (a *Alphabet) MaxLen() int {
+	return a.maxLen
+}
+
+// Encode returns the shortest encoding of num.
+func (a *Alphabet) Encode(num uint64) string {
+	return a.EncodeLen(num, 1)
+}
+
+// EncodeLen returns the encoding of num padded to at least length characters
+// with the zero character of the alphabet.
+func (a *Alphabet) EncodeLen(num uint64, length int) string {
+	base := uint64(len(a.chars))
+
+	// A 64-bit number is at most 64 characters long, in base 2
+	buf := make([]byte, max(length, 64))
+	i := len(buf)
+	for num > 0 || len(buf)-i < length {
+		i--
+		buf[i] = a.chars[num%base]
+		num /= base
+	}
+
+	return string(buf[i:])
+}
+
+// Decode returns the number s encodes, ignoring padding.
+func (a *Alphabet) Decode(s string) (uint64, error) {
+	if s == "" {
+		return 0, ErrInvalidChar
+	}
+
+	base := uint64(len(a.chars))
+
+	var num uint64
+	for i := range len(s) {
+		v := a.index[s[i]]
+		if v == 0 {
+			return 0, ErrInvalidChar
+		}
+		if num > (math.MaxUint64-uint64(v-1))/base {
+			return 0, ErrOverflow
+		}
+		num = num*base + uint64(v-1)
+	}
+
+	return num, nil
+}
+
+// Valid reports whether s is made of characters of the alphabet only.
+func (a *Alphabet) Valid(s string) bool {
+	for i := range len(s) {
+		if a.index[s[i]] == 0 {
+			return false
+		}
+	}
+
+	return s != ""
+}
+
+// Random returns a string of n characters drawn uniformly at random.
+func (a *Alphabet) Random(n int) string {
+	// Bytes past the largest multiple of the base would bias the draw
+	limit := 256 - 256%len(a.chars)
+
+	buf := make([]byte, n)
+	res := make([]byte, 0, n)
+	for len(res) < n {
+		_, _ = rand.Read(buf)
+		for _, b := range buf {
+			if int(b) < limit && len(res) < n {
+				res = append(res, a.chars[int(b)%len(a.chars)])
+			}
+		}
+	}
+
+	return string(res)
+}
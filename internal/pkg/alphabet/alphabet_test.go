@@ -0,0 +1,62 @@
+package alphabet
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	for _, a := range []*Alphabet{Base62, Base58, Base36} {
+		for _, num := range []uint64{0, 1, 61, 62, 1 << 40, math.MaxUint64} {
+			code := a.Encode(num)
+			got, err := a.Decode(code)
+			if err != nil || got != num {
+				t.Errorf("base %d: expected %q to decode to %d, got %d, %v", a.Base(), code, num, got, err)
+			}
+
+			padded := a.EncodeLen(num, 12)
+			if len(padded) < 12 {
+				t.Errorf("base %d: expected at least 12 characters, got %q", a.Base(), padded)
+			}
+			if got, _ := a.Decode(padded); got != num {
+				t.Errorf("base %d: expected padded %q to decode to %d, got %d", a.Base(), padded, num, got)
+			}
+		}
+	}
+
+	if code := Base62.Encode(1<<40 + 7); code != "jmaiJOD" {
+		t.Errorf("expected base62 encoding to stay stable, got %q", code)
+	}
+	if padded := Base36.EncodeLen(1, 100); len(padded) != 100 {
+		t.Errorf("expected 100 characters, got %d", len(padded))
+	}
+	if Base62.MaxLen() != 11 || Base58.MaxLen() != 11 || Base36.MaxLen() != 13 {
+		t.Errorf("unexpected max lengths %d, %d, %d", Base62.MaxLen(), Base58.MaxLen(), Base36.MaxLen())
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	if _, err := Base58.Decode("abc0"); !errors.Is(err, ErrInvalidChar) {
+		t.Errorf("expected ErrInvalidChar, got %v", err)
+	}
+	if _, err := Base36.Decode("ABC"); !errors.Is(err, ErrInvalidChar) {
+		t.Errorf("expected ErrInvalidChar, got %v", err)
+	}
+	if _, err := Base62.Decode("zzzzzzzzzzzz"); !errors.Is(err, ErrOverflow) {
+		t.Errorf("expected ErrOverflow, got %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, chars := range []string{"", "a", "abca", "ab c", "ab/", "ab?", "ab#", "ab%", "ab.", "ab&", "ab+", "abé"} {
+		if _, err := New(chars); err == nil {
+			t.Errorf("expected alphabet %q to be rejected", chars)
+		}
+	}
+
+	a, err := Named("0123456789")
+	if err != nil || a.Encode(1234) != "1234" {
+		t.Errorf("expected a custom decimal alphabet, got %v", err)
+	}
+}
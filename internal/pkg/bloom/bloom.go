@@ -0,0 +1,62 @@
+package bloom
+
+import (
+	"hash/maphash"
+	"math"
+	"sync/atomic"
+)
+
+// Filter is a Bloom filter of strings, safe for concurrent use. Test never
+// reports an added string as missing, but may report a missing one as added
+// at the false positive rate the filter was sized for.
+type Filter struct {
+	bits  []atomic.Uint64
+	m     uint64
+	k     uint64
+	seed1 maphash.Seed
+	seed2 maphash.Seed
+}
+
+// New returns a filter sized to hold n strings at false positive rate p.
+func New(n int, p float64) *Filter {
+	n = max(n, 1)
+	p = min(max(p, 1e-9), 0.5)
+
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k := uint64(max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+
+	return &Filter{
+		bits:  make([]atomic.Uint64, (m+63)/64),
+		m:     m,
+		k:     k,
+		seed1: maphash.MakeSeed(),
+		seed2: maphash.MakeSeed(),
+	}
+}
+
+func (f *Filter) Add(s string) {
+	h1, h2 := f.hash(s)
+	for i := range f.k {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64].Or(1 << (bit % 64))
+	}
+}
+
+// Test reports whether s may have been added.
+func (f *Filter) Test(s string) bool {
+	h1, h2 := f.hash(s)
+	for i := range f.k {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64].Load()&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hash returns the two hashes the k bits of s are derived from, by double
+// hashing.
+func (f *Filter) hash(s string) (uint64, uint64) {
+	return maphash.String(f.seed1, s), maphash.String(f.seed2, s) | 1
+}
@@ -0,0 +1,29 @@
+package bloom
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	f := New(10000, 0.01)
+
+	for i := range 10000 {
+		f.Add("added:" + strconv.Itoa(i))
+	}
+	for i := range 10000 {
+		if !f.Test("added:" + strconv.Itoa(i)) {
+			t.Fatalf("expected added string %d to be found", i)
+		}
+	}
+
+	falsePositives := 0
+	for i := range 10000 {
+		if f.Test("missing:" + strconv.Itoa(i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 200 {
+		t.Errorf("expected about 1%% false positives, got %d in 10000", falsePositives)
+	}
+}
@@ -0,0 +1,199 @@
+package canonical
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// DefaultTrackingParams are query params only used to track clicks. A
+// trailing * matches any param starting with what precedes it.
+var DefaultTrackingParams = []string{
+	"utm_*",
+	"fbclid",
+	"gclid",
+	"dclid",
+	"msclkid",
+	"yclid",
+	"igshid",
+	"mc_cid",
+	"mc_eid",
+	"_hsenc",
+	"_hsmi",
+}
+
+type Options struct {
+	// Sort query params by name, keeping the order of repeated params
+	SortQuery bool
+	// Drop the query params listed in TrackingParams
+	StripTracking  bool
+	TrackingParams []string
+}
+
+// Canonicalizer rewrites URLs that lead to the same resource to the same
+// string, so that they hash and deduplicate the same.
+type Canonicalizer struct {
+	opts Options
+}
+
+func New(opts Options) *Canonicalizer {
+	if opts.StripTracking && opts.TrackingParams == nil {
+		opts.TrackingParams = DefaultTrackingParams
+	}
+
+	return &Canonicalizer{opts: opts}
+}
+
+// URL returns the canonical form of rawURL: lowercased scheme and host,
+// without default port, with a normalized path encoding, and with the query
+// rewritten as configured. Canonicalizing a canonical URL returns it as is.
+func (c *Canonicalizer) URL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "" {
+		sb.WriteString(scheme + ":")
+	}
+	if u.Opaque != "" {
+		// e.g. mailto:, nothing to normalize
+		sb.WriteString(u.Opaque)
+	} else if u.Host != "" || scheme != "" {
+		sb.WriteString("//")
+		if u.User != nil {
+			sb.WriteString(u.User.String() + "@")
+		}
+		sb.WriteString(canonicalHost(u, scheme))
+
+		path := normalizeEscapes(u.EscapedPath())
+		if path == "" {
+			path = "/"
+		}
+		sb.WriteString(path)
+	}
+
+	if query := c.canonicalQuery(u.RawQuery); query != "" {
+		sb.WriteString("?" + query)
+	}
+
+	if u.Fragment != "" {
+		sb.WriteString("#" + normalizeEscapes(u.EscapedFragment()))
+	}
+
+	return sb.String(), nil
+}
+
+func canonicalHost(u *url.URL, scheme string) string {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	switch port := u.Port(); {
+	case port == "", scheme == "http" && port == "80", scheme == "https" && port == "443":
+		return host
+	default:
+		return host + ":" + port
+	}
+}
+
+// canonicalQuery rewrites a raw query, keeping the encoding of the params it
+// keeps so that the destination receives them unchanged.
+func (c *Canonicalizer) canonicalQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	var params []string
+	for _, p := range strings.Split(rawQuery, "&") {
+		if p == "" {
+			continue
+		}
+		if c.opts.StripTracking && c.isTrackingParam(paramName(p)) {
+			continue
+		}
+		params = append(params, normalizeEscapes(p))
+	}
+
+	if c.opts.SortQuery {
+		sort.SliceStable(params, func(i, j int) bool {
+			return paramName(params[i]) < paramName(params[j])
+		})
+	}
+
+	return strings.Join(params, "&")
+}
+
+func (c *Canonicalizer) isTrackingParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, t := range c.opts.TrackingParams {
+		if prefix, ok := strings.CutSuffix(t, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+func paramName(param string) string {
+	name, _, _ := strings.Cut(param, "=")
+	if n, err := url.QueryUnescape(name); err == nil {
+		return n
+	}
+
+	return name
+}
+
+// normalizeEscapes decodes percent-encoded unreserved characters, which
+// never need encoding, and uppercases the hex digits of the other escapes.
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			sb.WriteByte(s[i])
+			continue
+		}
+
+		b := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(b) {
+			sb.WriteByte(b)
+		} else {
+			sb.WriteString("%" + strings.ToUpper(s[i+1:i+3]))
+		}
+		i += 2
+	}
+
+	return sb.String()
+}
+
+func isUnreserved(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' ||
+		b == '-' || b == '.' || b == '_' || b == '~'
+}
+
+func isHex(b byte) bool {
+	return '0' <= b && b <= '9' || 'a' <= b && b <= 'f' || 'A' <= b && b <= 'F'
+}
+
+func unhex(b byte) byte {
+	switch {
+	case '0' <= b && b <= '9':
+		return b - '0'
+	case 'a' <= b && b <= 'f':
+		return b - 'a' + 10
+	default:
+		return b - 'A' + 10
+	}
+}
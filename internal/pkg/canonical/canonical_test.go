@@ -0,0 +1,50 @@
+package canonical
+
+import "testing"
+
+func TestCanonicalizer(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		in   string
+		want string
+	}{
+		{"lowercases scheme and host", Options{}, "HTTPS://Example.COM/A", "https://example.com/A"},
+		{"drops an empty query", Options{}, "https://example.com/a?", "https://example.com/a"},
+		{"adds the root path", Options{}, "https://example.com", "https://example.com/"},
+		{"strips default ports", Options{}, "http://example.com:80/a", "http://example.com/a"},
+		{"keeps other ports", Options{}, "https://example.com:8443/a", "https://example.com:8443/a"},
+		{"keeps IPv6 hosts", Options{}, "http://[::1]:80/", "http://[::1]/"},
+		{"normalizes path escapes", Options{}, "https://example.com/%7euser/a%2fb%c3%a9", "https://example.com/~user/a%2Fb%C3%A9"},
+		{"keeps the query order by default", Options{}, "https://example.com/?b=1&a=2", "https://example.com/?b=1&a=2"},
+		{"sorts query params", Options{SortQuery: true}, "https://example.com/?b=1&a=2&b=0", "https://example.com/?a=2&b=1&b=0"},
+		{"keeps tracking params by default", Options{}, "https://example.com/?utm_source=x", "https://example.com/?utm_source=x"},
+		{
+			"strips tracking params",
+			Options{StripTracking: true},
+			"https://example.com/?utm_source=x&id=1&fbclid=abc&UTM_Medium=y",
+			"https://example.com/?id=1",
+		},
+		{"keeps query value encoding", Options{SortQuery: true}, "https://example.com/?q=a+b%2bc", "https://example.com/?q=a+b%2Bc"},
+		{"keeps fragments", Options{}, "https://example.com/a#Top", "https://example.com/a#Top"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(tt.opts)
+
+			got, err := c.URL(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("URL(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+
+			again, _ := c.URL(got)
+			if again != got {
+				t.Errorf("URL(%q) = %q, expected canonical URLs to be left as is", got, again)
+			}
+		})
+	}
+}
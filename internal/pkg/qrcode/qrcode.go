@@ -0,0 +1,116 @@
+package qrcode
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+
+	"rsc.io/qr"
+)
+
+var ErrInvalidLevel = errors.New("level must be one of L, M, Q, H")
+
+// Level is the error correction level of a QR code, from the least (L) to
+// the most (H) tolerant of damage.
+type Level = qr.Level
+
+// ParseLevel parses an error correction level name, case-insensitively.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToUpper(s) {
+	case "L":
+		return qr.L, nil
+	case "M":
+		return qr.M, nil
+	case "Q":
+		return qr.Q, nil
+	case "H":
+		return qr.H, nil
+	}
+
+	return 0, ErrInvalidLevel
+}
+
+// Code is an encoded QR code, surrounded by a quiet zone of margin modules.
+type Code struct {
+	code   *qr.Code
+	margin int
+}
+
+func Encode(text string, level Level, margin int) (*Code, error) {
+	code, err := qr.Encode(text, level)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Code{code: code, margin: margin}, nil
+}
+
+// Modules returns the number of modules on a side, quiet zone included.
+func (c *Code) Modules() int {
+	return c.code.Size + 2*c.margin
+}
+
+func (c *Code) black(x, y int) bool {
+	return c.code.Black(x-c.margin, y-c.margin)
+}
+
+// WritePNG renders the code as a size x size PNG. Modules are drawn with
+// whole pixels, so the code is centered when size is not a multiple of the
+// module count.
+func (c *Code) WritePNG(w io.Writer, size int) error {
+	modules := c.Modules()
+	scale := max(size/modules, 1)
+	size = max(size, modules)
+	offset := (size - modules*scale) / 2
+
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{color.White, color.Black})
+	for y := 0; y < modules; y++ {
+		for x := 0; x < modules; x++ {
+			if !c.black(x, y) {
+				continue
+			}
+
+			for py := 0; py < scale; py++ {
+				row := img.Pix[(offset+y*scale+py)*img.Stride:]
+				for px := 0; px < scale; px++ {
+					row[offset+x*scale+px] = 1
+				}
+			}
+		}
+	}
+
+	return png.Encode(w, img)
+}
+
+// WriteSVG renders the code as a size x size SVG. The code is drawn in
+// module units and scaled by the viewBox, so it stays sharp at any size.
+func (c *Code) WriteSVG(w io.Writer, size int) error {
+	modules := c.Modules()
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, modules, modules)
+	fmt.Fprintf(bw, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, modules, modules)
+	for y := 0; y < modules; y++ {
+		for x := 0; x < modules; {
+			if !c.black(x, y) {
+				x++
+				continue
+			}
+
+			// Merge horizontal runs of black modules into one rectangle
+			start := x
+			for x < modules && c.black(x, y) {
+				x++
+			}
+			fmt.Fprintf(bw, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+	bw.WriteString(`"/></svg>`)
+
+	return bw.Flush()
+}
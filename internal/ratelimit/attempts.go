@@ -0,0 +1,178 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Attempts counts failures per key, such as wrong passwords, in fixed
+// windows starting at the first failure, and blocks a key once it failed max
+// times until its window ends.
+type Attempts interface {
+	// Blocked returns how long key is still blocked for, or zero.
+	Blocked(ctx context.Context, key string) (time.Duration, error)
+	Fail(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
+}
+
+// MemoryAttempts keeps the failures in process, so each replica enforces the
+// limit on its own and counts start over on restart.
+type MemoryAttempts struct {
+	max    int
+	window time.Duration
+
+	mu       sync.Mutex
+	failures map[string]*attemptWindow
+}
+
+type attemptWindow struct {
+	count   int
+	resetAt time.Time
+}
+
+func NewMemoryAttempts(max int, window time.Duration) *MemoryAttempts {
+	return &MemoryAttempts{
+		max:      max,
+		window:   window,
+		failures: make(map[string]*attemptWindow),
+	}
+}
+
+func (a *MemoryAttempts) Blocked(ctx context.Context, key string) (time.Duration, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	w, ok := a.failures[key]
+	if !ok || w.count < a.max {
+		return 0, nil
+	}
+
+	return max(time.Until(w.resetAt), 0), nil
+}
+
+func (a *MemoryAttempts) Fail(ctx context.Context, key string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+
+	w, ok := a.failures[key]
+	if !ok || !now.Before(w.resetAt) {
+		// Windows of other keys that ended are dropped along the way
+		for k, w := range a.failures {
+			if !now.Before(w.resetAt) {
+				delete(a.failures, k)
+			}
+		}
+
+		w = &attemptWindow{resetAt: now.Add(a.window)}
+		a.failures[key] = w
+	}
+	w.count++
+
+	return nil
+}
+
+func (a *MemoryAttempts) Reset(ctx context.Context, key string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.failures, key)
+	return nil
+}
+
+// failScript counts a failure, starting the window of the key on the first.
+var failScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// RedisAttempts keeps the failures in Redis, so that the limit holds across
+// replicas and restarts.
+type RedisAttempts struct {
+	rdb    *redis.Client
+	prefix string
+	max    int
+	window time.Duration
+}
+
+// NewRedisAttempts returns attempts stored under keys starting with prefix,
+// which must be unique to the policy.
+func NewRedisAttempts(rdb *redis.Client, prefix string, max int, window time.Duration) *RedisAttempts {
+	return &RedisAttempts{rdb: rdb, prefix: prefix, max: max, window: window}
+}
+
+func (a *RedisAttempts) Blocked(ctx context.Context, key string) (time.Duration, error) {
+	pipe := a.rdb.Pipeline()
+	count := pipe.Get(ctx, a.prefix+key)
+	ttl := pipe.PTTL(ctx, a.prefix+key)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, err
+	}
+
+	n, err := count.Int()
+	if err == redis.Nil || n < a.max {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	return max(ttl.Val(), 0), nil
+}
+
+func (a *RedisAttempts) Fail(ctx context.Context, key string) error {
+	return failScript.Run(ctx, a.rdb, []string{a.prefix + key}, a.window.Milliseconds()).Err()
+}
+
+func (a *RedisAttempts) Reset(ctx context.Context, key string) error {
+	return a.rdb.Del(ctx, a.prefix+key).Err()
+}
+
+// FallbackAttempts counts failures with Primary, and with Secondary whenever
+// Primary fails, e.g. Redis backed by the process during an outage.
+type FallbackAttempts struct {
+	Primary   Attempts
+	Secondary Attempts
+	// OnError, if set, is called with the errors of Primary
+	OnError func(error)
+}
+
+func (f *FallbackAttempts) Blocked(ctx context.Context, key string) (time.Duration, error) {
+	wait, err := f.Primary.Blocked(ctx, key)
+	if err == nil {
+		return wait, nil
+	}
+	f.onError(err)
+
+	return f.Secondary.Blocked(ctx, key)
+}
+
+func (f *FallbackAttempts) Fail(ctx context.Context, key string) error {
+	if err := f.Primary.Fail(ctx, key); err != nil {
+		f.onError(err)
+		return f.Secondary.Fail(ctx, key)
+	}
+
+	return nil
+}
+
+func (f *FallbackAttempts) Reset(ctx context.Context, key string) error {
+	if err := f.Primary.Reset(ctx, key); err != nil {
+		f.onError(err)
+	}
+
+	// The failures may have been counted by either
+	return f.Secondary.Reset(ctx, key)
+}
+
+func (f *FallbackAttempts) onError(err error) {
+	if f.OnError != nil {
+		f.OnError(err)
+	}
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestAttempts(t *testing.T) {
+	ctx := context.Background()
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+
+	for name, attempts := range map[string]Attempts{
+		"memory": NewMemoryAttempts(2, time.Minute),
+		"redis":  NewRedisAttempts(rdb, "pw:", 2, time.Minute),
+	} {
+		t.Run(name, func(t *testing.T) {
+			for i := range 2 {
+				if wait, err := attempts.Blocked(ctx, "a"); err != nil || wait != 0 {
+					t.Fatalf("expected a not to be blocked after %d failures, got %v, %v", i, wait, err)
+				}
+				if err := attempts.Fail(ctx, "a"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if wait, _ := attempts.Blocked(ctx, "a"); wait <= 0 || wait > time.Minute {
+				t.Errorf("expected a to be blocked for at most a minute, got %v", wait)
+			}
+			if wait, _ := attempts.Blocked(ctx, "b"); wait != 0 {
+				t.Errorf("expected keys to be counted separately, got %v", wait)
+			}
+
+			if err := attempts.Reset(ctx, "a"); err != nil {
+				t.Fatal(err)
+			}
+			if wait, _ := attempts.Blocked(ctx, "a"); wait != 0 {
+				t.Errorf("expected a reset key not to be blocked, got %v", wait)
+			}
+		})
+	}
+
+	t.Run("should fall back while redis fails", func(t *testing.T) {
+		down := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+		defer down.Close()
+
+		var failures int
+		attempts := &FallbackAttempts{
+			Primary:   NewRedisAttempts(down, "pw:", 1, time.Minute),
+			Secondary: NewMemoryAttempts(1, time.Minute),
+			OnError:   func(error) { failures++ },
+		}
+
+		if err := attempts.Fail(ctx, "a"); err != nil {
+			t.Fatal(err)
+		}
+		if wait, err := attempts.Blocked(ctx, "a"); err != nil || wait <= 0 {
+			t.Errorf("expected a to be blocked in process, got %v, %v", wait, err)
+		}
+		if failures != 2 {
+			t.Errorf("expected both redis errors to be reported, got %d", failures)
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// MemoryLimiter allows bursts of up to limit requests per key, refilling at
+// limit requests per window, as token buckets held in process. Each replica
+// enforces its own limit.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	limit     int
+	window    time.Duration
+	buckets   map[string]*bucket
+	lastSweep time.Time
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewMemoryLimiter(limit int, window time.Duration) *MemoryLimiter {
+	return &MemoryLimiter{
+		limit:   limit,
+		window:  window,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (l *MemoryLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+func (l *MemoryLimiter) AllowN(ctx context.Context, key string, n int) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.last = now
+
+	result := Result{Limit: l.limit, Window: l.window}
+	if n <= l.limit && b.tokens >= float64(n) {
+		b.tokens -= float64(n)
+		result.Allowed = true
+	} else {
+		result.RetryAfter = l.timeToFill(math.Min(float64(n), float64(l.limit)) - b.tokens)
+	}
+
+	result.Remaining = int(b.tokens)
+	result.Reset = l.timeToFill(float64(l.limit) - b.tokens)
+
+	return result, nil
+}
+
+// refill returns the tokens of b at now.
+func (l *MemoryLimiter) refill(b *bucket, now time.Time) float64 {
+	elapsed := now.Sub(b.last)
+	return math.Min(float64(l.limit), b.tokens+float64(l.limit)*elapsed.Seconds()/l.window.Seconds())
+}
+
+// timeToFill returns the time the bucket takes to gain tokens.
+func (l *MemoryLimiter) timeToFill(tokens float64) time.Duration {
+	return time.Duration(math.Ceil(tokens * float64(l.window) / float64(l.limit)))
+}
+
+// sweep drops the buckets that refilled completely, which behave as missing
+// ones, at most once per window.
+func (l *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= float64(l.limit) {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Unix(0, 0)
+	l := NewMemoryLimiter(2, time.Minute)
+	l.now = func() time.Time { return now }
+
+	for i, want := range []bool{true, true, false} {
+		res, _ := l.Allow(ctx, "a")
+		if res.Allowed != want {
+			t.Fatalf("request %d: expected allowed=%v, got %v", i, want, res.Allowed)
+		}
+	}
+
+	res, _ := l.Allow(ctx, "a")
+	if res.Remaining != 0 || res.RetryAfter != 30*time.Second || res.Reset != time.Minute {
+		t.Errorf("expected 0 remaining, retry after 30s and reset in 1m, got %+v", res)
+	}
+
+	if res, _ := l.Allow(ctx, "b"); !res.Allowed || res.Remaining != 1 {
+		t.Errorf("expected keys to be limited separately, got %+v", res)
+	}
+
+	now = now.Add(30 * time.Second)
+	if res, _ := l.Allow(ctx, "a"); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("expected a token after half a window, got %+v", res)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if res, _ := l.Allow(ctx, "c"); !res.Allowed {
+		t.Errorf("expected a new key to be allowed, got %+v", res)
+	}
+	if _, ok := l.buckets["a"]; ok {
+		t.Error("expected full buckets to be swept")
+	}
+}
+
+func TestMemoryLimiterAllowN(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Unix(0, 0)
+	l := NewMemoryLimiter(4, time.Minute)
+	l.now = func() time.Time { return now }
+
+	if res, _ := l.AllowN(ctx, "a", 3); !res.Allowed || res.Remaining != 1 {
+		t.Fatalf("expected 3 requests to be allowed, got %+v", res)
+	}
+
+	res, _ := l.AllowN(ctx, "a", 2)
+	if res.Allowed || res.Remaining != 1 || res.RetryAfter != 15*time.Second {
+		t.Errorf("expected 2 requests to be refused together until a token refills, got %+v", res)
+	}
+
+	if res, _ := l.AllowN(ctx, "b", 5); res.Allowed {
+		t.Errorf("expected requests beyond the limit to be refused, got %+v", res)
+	}
+}
@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Result is the outcome of a request against a limit.
+type Result struct {
+	Allowed bool
+	// Limit is the number of requests allowed per Window
+	Limit  int
+	Window time.Duration
+	// Remaining is the number of requests still allowed right now
+	Remaining int
+	// Reset is the time until the full limit is available again
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, 0 if it
+	// already is
+	RetryAfter time.Duration
+}
+
+type Limiter interface {
+	// Allow counts a request of key against the limit, unless it is refused.
+	Allow(ctx context.Context, key string) (Result, error)
+	// AllowN counts n requests of key at once, unless they are refused
+	// together. More than the limit are always refused.
+	AllowN(ctx context.Context, key string, n int) (Result, error)
+}
+
+// Fallback limits requests with Primary, and with Secondary whenever Primary
+// fails, e.g. a Redis limiter backed by a per-process one during an outage.
+type Fallback struct {
+	Primary   Limiter
+	Secondary Limiter
+	// OnError, if set, is called with the errors of Primary
+	OnError func(error)
+}
+
+func (f *Fallback) Allow(ctx context.Context, key string) (Result, error) {
+	return f.AllowN(ctx, key, 1)
+}
+
+func (f *Fallback) AllowN(ctx context.Context, key string, n int) (Result, error) {
+	res, err := f.Primary.AllowN(ctx, key, n)
+	if err == nil {
+		return res, nil
+	}
+
+	if f.OnError != nil {
+		f.OnError(err)
+	}
+
+	return f.Secondary.AllowN(ctx, key, n)
+}
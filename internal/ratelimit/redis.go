@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// slidingWindowScript keeps the timestamps, in microseconds of the Redis
+// clock, of the requests allowed within the last window in a sorted set. The
+// n requests are allowed if they fit within limit once older ones are
+// dropped. Returns whether they were allowed, the requests left, and the
+// microseconds until the newest request leaves the window and until enough
+// have left for the n requests to fit.
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local n = tonumber(ARGV[4])
+
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+
+local count = redis.call("ZCARD", KEYS[1])
+local allowed = 0
+if count + n <= limit then
+	for i = 1, n do
+		redis.call("ZADD", KEYS[1], now, now .. ":" .. ARGV[3] .. ":" .. i)
+	end
+	count = count + n
+	allowed = 1
+end
+redis.call("PEXPIRE", KEYS[1], math.ceil(window / 1000))
+
+local newest = redis.call("ZRANGE", KEYS[1], -1, -1, "WITHSCORES")
+local reset, retry = 0, 0
+if newest[2] then
+	reset = tonumber(newest[2]) + window - now
+end
+if allowed == 0 then
+	-- The last request that must leave the window for the n to fit, or for
+	-- the window to empty if n is beyond the limit
+	local i = math.min(count + n - limit, count) - 1
+	local last = redis.call("ZRANGE", KEYS[1], i, i, "WITHSCORES")
+	if last[2] then
+		retry = tonumber(last[2]) + window - now
+	end
+end
+
+return {allowed, limit - count, reset, retry}
+`)
+
+// RedisLimiter allows limit requests per key within any window, as a
+// sliding window log in Redis, so that the limit holds across replicas.
+type RedisLimiter struct {
+	rdb    *redis.Client
+	prefix string
+	limit  int
+	window time.Duration
+}
+
+// NewRedisLimiter returns a limiter storing its windows under keys starting
+// with prefix, which must be unique to the policy.
+func NewRedisLimiter(rdb *redis.Client, prefix string, limit int, window time.Duration) *RedisLimiter {
+	return &RedisLimiter{rdb: rdb, prefix: prefix, limit: limit, window: window}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+func (l *RedisLimiter) AllowN(ctx context.Context, key string, n int) (Result, error) {
+	// Requests within the same microsecond still need distinct members
+	nonce := make([]byte, 4)
+	_, _ = rand.Read(nonce)
+
+	res, err := slidingWindowScript.Run(ctx, l.rdb, []string{l.prefix + key},
+		l.limit, l.window.Microseconds(), hex.EncodeToString(nonce), n).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{
+		Allowed:   res[0] == 1,
+		Limit:     l.limit,
+		Window:    l.window,
+		Remaining: int(res[1]),
+		Reset:     time.Duration(res[2]) * time.Microsecond,
+	}
+	if !result.Allowed {
+		result.RetryAfter = time.Duration(res[3]) * time.Microsecond
+	}
+
+	return result, nil
+}
@@ -0,0 +1,40 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisLimiter(t *testing.T) {
+	ctx := context.Background()
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+
+	l := NewRedisLimiter(rdb, "rl:test:", 4, time.Minute)
+
+	if res, err := l.Allow(ctx, "a"); err != nil || !res.Allowed || res.Remaining != 3 {
+		t.Fatalf("expected a request to be allowed, got %+v, %v", res, err)
+	}
+
+	if res, err := l.AllowN(ctx, "a", 3); err != nil || !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("expected 3 more requests to be allowed, got %+v, %v", res, err)
+	}
+
+	res, err := l.AllowN(ctx, "a", 2)
+	if err != nil || res.Allowed || res.RetryAfter <= 0 || res.RetryAfter > time.Minute {
+		t.Errorf("expected 2 requests to be refused until the window moves, got %+v, %v", res, err)
+	}
+
+	if res, _ := l.AllowN(ctx, "b", 5); res.Allowed {
+		t.Errorf("expected requests beyond the limit to be refused, got %+v", res)
+	}
+	if res, _ := l.AllowN(ctx, "b", 4); !res.Allowed {
+		t.Errorf("expected refused requests not to be counted, got %+v", res)
+	}
+}
@@ -0,0 +1,84 @@
+package safety
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Verdict is the result of a safety check of a URL.
+type Verdict struct {
+	Blocked bool
+	// Why the URL is blocked, shown to API clients and on the warning page
+	Reason string
+}
+
+// allowed returns a fresh verdict letting a URL through, so that callers may
+// change it without affecting the others.
+func allowed() *Verdict {
+	return &Verdict{}
+}
+
+// Checker tells whether a destination URL is safe to shorten and redirect to.
+type Checker interface {
+	Check(ctx context.Context, rawURL string) (*Verdict, error)
+}
+
+type Config struct {
+	// File of blocked domains, one per line
+	BlocklistFile string
+	// File of regular expressions matched against whole URLs, one per line
+	DenylistFile string
+	// Endpoint of a URL reputation lookup service
+	LookupURL     string
+	LookupTimeout time.Duration
+}
+
+// New returns a checker running every check enabled in cfg, cheapest first.
+// Without any, every URL is allowed.
+func New(cfg Config) (Checker, error) {
+	var checkers Multi
+
+	if cfg.BlocklistFile != "" {
+		c, err := NewDomainBlocklistFromFile(cfg.BlocklistFile)
+		if err != nil {
+			return nil, err
+		}
+		checkers = append(checkers, c)
+	}
+
+	if cfg.DenylistFile != "" {
+		c, err := NewRegexDenylistFromFile(cfg.DenylistFile)
+		if err != nil {
+			return nil, err
+		}
+		checkers = append(checkers, c)
+	}
+
+	if cfg.LookupURL != "" {
+		checkers = append(checkers, NewLookupChecker(cfg.LookupURL, cfg.LookupTimeout))
+	}
+
+	return checkers, nil
+}
+
+// Multi runs checkers in order, and stops at the first that blocks the URL.
+type Multi []Checker
+
+func (m Multi) Check(ctx context.Context, rawURL string) (*Verdict, error) {
+	var errs []error
+	for _, c := range m {
+		v, err := c.Check(ctx, rawURL)
+		if err != nil {
+			// A failing checker must not hide the verdict of the others
+			errs = append(errs, err)
+			continue
+		}
+
+		if v.Blocked {
+			return v, nil
+		}
+	}
+
+	return allowed(), errors.Join(errs...)
+}
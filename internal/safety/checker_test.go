@@ -0,0 +1,97 @@
+package safety
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckers(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should block listed domains and their subdomains", func(t *testing.T) {
+		b := NewDomainBlocklist([]string{"evil.com"})
+
+		for rawURL, blocked := range map[string]bool{
+			"https://evil.com/login":         true,
+			"https://login.EVIL.com./x":      true,
+			"https://notevil.com/":           false,
+			"https://evil.com.example.org/x": false,
+		} {
+			v, err := b.Check(ctx, rawURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.Blocked != blocked {
+				t.Errorf("%s: expected blocked=%v, got %v", rawURL, blocked, v.Blocked)
+			}
+		}
+	})
+
+	t.Run("should block URLs matching a denylisted pattern", func(t *testing.T) {
+		d, err := NewRegexDenylist([]string{`(?i)/wp-login\.php`})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if v, _ := d.Check(ctx, "https://example.com/WP-LOGIN.php"); !v.Blocked {
+			t.Error("expected the URL to be blocked")
+		}
+		if v, _ := d.Check(ctx, "https://example.com/blog"); v.Blocked {
+			t.Error("expected the URL to be allowed")
+		}
+	})
+
+	t.Run("should ask the lookup service", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req lookupRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+
+			res := lookupResponse{}
+			if req.URL == "https://phish.example/" {
+				res = lookupResponse{Blocked: true, Reason: "phishing"}
+			}
+			_ = json.NewEncoder(w).Encode(res)
+		}))
+		defer srv.Close()
+
+		c := NewLookupChecker(srv.URL, time.Second)
+
+		if v, err := c.Check(ctx, "https://phish.example/"); err != nil || !v.Blocked || v.Reason != "phishing" {
+			t.Errorf("expected a phishing verdict, got %+v, %v", v, err)
+		}
+		if v, err := c.Check(ctx, "https://google.com/"); err != nil || v.Blocked {
+			t.Errorf("expected the URL to be allowed, got %+v, %v", v, err)
+		}
+	})
+
+	t.Run("should keep blocking when another checker fails", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+
+		m := Multi{NewLookupChecker(srv.URL, time.Second), NewDomainBlocklist([]string{"evil.com"})}
+
+		if v, err := m.Check(ctx, "https://evil.com/"); err != nil || !v.Blocked {
+			t.Errorf("expected the URL to be blocked, got %+v, %v", v, err)
+		}
+		if v, err := m.Check(ctx, "https://google.com/"); err == nil || v.Blocked {
+			t.Errorf("expected the lookup error with an allowed verdict, got %+v, %v", v, err)
+		}
+	})
+
+	t.Run("should not share allowed verdicts between calls", func(t *testing.T) {
+		b := NewDomainBlocklist([]string{"evil.com"})
+
+		v, _ := b.Check(ctx, "https://google.com/")
+		v.Blocked = true
+
+		if v, _ := b.Check(ctx, "https://google.com/"); v.Blocked {
+			t.Error("expected a change to one verdict not to leak into the next")
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package safety
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// DomainBlocklist blocks URLs whose host is a listed domain or one of its
+// subdomains.
+type DomainBlocklist struct {
+	domains map[string]struct{}
+}
+
+func NewDomainBlocklist(domains []string) *DomainBlocklist {
+	b := &DomainBlocklist{domains: make(map[string]struct{}, len(domains))}
+	for _, d := range domains {
+		b.domains[strings.TrimSuffix(strings.ToLower(d), ".")] = struct{}{}
+	}
+
+	return b
+}
+
+func NewDomainBlocklistFromFile(path string) (*DomainBlocklist, error) {
+	lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDomainBlocklist(lines), nil
+}
+
+func (b *DomainBlocklist) Check(ctx context.Context, rawURL string) (*Verdict, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	for host != "" {
+		if _, ok := b.domains[host]; ok {
+			return &Verdict{Blocked: true, Reason: fmt.Sprintf("domain %s is blocklisted", host)}, nil
+		}
+
+		_, host, _ = strings.Cut(host, ".")
+	}
+
+	return allowed(), nil
+}
+
+// RegexDenylist blocks URLs matching any of its patterns.
+type RegexDenylist struct {
+	patterns []*regexp.Regexp
+}
+
+func NewRegexDenylist(patterns []string) (*RegexDenylist, error) {
+	d := &RegexDenylist{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("denylist pattern %q: %w", p, err)
+		}
+		d.patterns = append(d.patterns, re)
+	}
+
+	return d, nil
+}
+
+func NewRegexDenylistFromFile(path string) (*RegexDenylist, error) {
+	lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRegexDenylist(lines)
+}
+
+func (d *RegexDenylist) Check(ctx context.Context, rawURL string) (*Verdict, error) {
+	for _, re := range d.patterns {
+		if re.MatchString(rawURL) {
+			return &Verdict{Blocked: true, Reason: "url matches a denylisted pattern"}, nil
+		}
+	}
+
+	return allowed(), nil
+}
+
+// readLines returns the lines of a list file, skipping blank lines and
+// comments starting with #.
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, scanner.Err()
+}
@@ -0,0 +1,73 @@
+package safety
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// LookupChecker asks a Safe-Browsing-style reputation service about URLs.
+// It POSTs {"url": "..."} to the endpoint, which answers
+// {"blocked": true, "reason": "..."} for unsafe URLs.
+type LookupChecker struct {
+	endpoint string
+	client   *http.Client
+}
+
+func NewLookupChecker(endpoint string, timeout time.Duration) *LookupChecker {
+	return &LookupChecker{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+type lookupRequest struct {
+	URL string `json:"url"`
+}
+
+type lookupResponse struct {
+	Blocked bool   `json:"blocked"`
+	Reason  string `json:"reason"`
+}
+
+func (c *LookupChecker) Check(ctx context.Context, rawURL string) (*Verdict, error) {
+	body, err := json.Marshal(lookupRequest{URL: rawURL})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("url lookup returned status %d", res.StatusCode)
+	}
+
+	var lr lookupResponse
+	if err := json.NewDecoder(res.Body).Decode(&lr); err != nil {
+		return nil, err
+	}
+
+	if !lr.Blocked {
+		return allowed(), nil
+	}
+
+	reason := lr.Reason
+	if reason == "" {
+		reason = "url is flagged by the reputation service"
+	}
+
+	return &Verdict{Blocked: true, Reason: reason}, nil
+}
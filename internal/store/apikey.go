@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+)
+
+// apiKeyPrefix makes keys recognizable, e.g. in secret scanners.
+const apiKeyPrefix = "us_"
+
+type APIKey struct {
+	ID        uint64     `json:"id"`
+	Name      string     `json:"name"`
+	KeyHash   string     `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+type APIKeyStore struct {
+	db *sql.DB
+}
+
+// GenerateAPIKey returns a new random API key. Only its hash is ever stored.
+func GenerateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashAPIKey returns the SHA-256 hex digest stored for an API key. Keys are
+// long random strings, so a fast unsalted hash is enough.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *APIKeyStore) Create(ctx context.Context, key *APIKey) error {
+	key.CreatedAt = time.Now().UTC()
+
+	query := `
+		INSERT INTO api_keys (name, key_hash, created_at)
+		VALUES (?, ?, ?)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, key.Name, key.KeyHash, key.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	key.ID = uint64(id)
+
+	return nil
+}
+
+// GetByHash returns the API key with the given hash, unless it was revoked.
+func (s *APIKeyStore) GetByHash(ctx context.Context, keyHash string) (*APIKey, error) {
+	query := `
+		SELECT id, name, key_hash, created_at, revoked_at
+		FROM api_keys
+		WHERE key_hash = ? AND revoked_at IS NULL
+		LIMIT 1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	key := &APIKey{}
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		keyHash,
+	).Scan(
+		&key.ID,
+		&key.Name,
+		&key.KeyHash,
+		&key.CreatedAt,
+		&key.RevokedAt,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
@@ -0,0 +1,187 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/huynguyenanh2000/url-shorterner/internal/store"
+)
+
+// LRUURLStore is a size-bounded in-process cache of URLs, evicting the least
+// recently used entry when full. Entries also expire after a TTL.
+type LRUURLStore struct {
+	mu          sync.Mutex
+	size        int
+	ttl         time.Duration
+	negativeTTL time.Duration
+	ll          *list.List
+	items       map[string]*list.Element
+}
+
+type lruEntry struct {
+	key       string
+	url       store.URL
+	expiresAt time.Time
+	// missing marks short URLs known not to exist
+	missing bool
+}
+
+func NewLRUURLStore(size int, ttl, negativeTTL time.Duration) *LRUURLStore {
+	return &LRUURLStore{
+		size:        size,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		ll:          list.New(),
+		items:       make(map[string]*list.Element),
+	}
+}
+
+func (s *LRUURLStore) GetByLongURLHash(ctx context.Context, ownerID uint64, domain, longURLHash string) (*store.URL, error) {
+	url, _ := s.get(longURLKey(ownerID, domain, longURLHash))
+	return url, nil
+}
+
+// GetByShortURL returns store.ErrNotFound if the short URL is known not to
+// exist.
+func (s *LRUURLStore) GetByShortURL(ctx context.Context, domain, shortURL string) (*store.URL, error) {
+	url, missing := s.get(shortURLKey(domain, shortURL))
+	if missing {
+		return nil, store.ErrNotFound
+	}
+
+	return url, nil
+}
+
+// SetMissing caches that a short URL does not exist for a short while. It
+// never replaces a cached URL, so a link created in the meantime wins.
+func (s *LRUURLStore) SetMissing(ctx context.Context, domain, shortURL string) error {
+	s.setMissing(shortURLKey(domain, shortURL))
+	return nil
+}
+
+// setMissing caches that the short URL of key does not exist.
+func (s *LRUURLStore) setMissing(key string) {
+	if s.negativeTTL <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.items[key]; ok && time.Now().Before(el.Value.(*lruEntry).expiresAt) {
+		return
+	}
+	s.add(&lruEntry{key: key, expiresAt: time.Now().Add(s.negativeTTL), missing: true})
+}
+
+// get returns the URL cached under key, or true if it is known missing.
+func (s *LRUURLStore) get(key string) (*store.URL, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := el.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		s.removeElement(el)
+		return nil, false
+	}
+
+	s.ll.MoveToFront(el)
+
+	if entry.missing {
+		return nil, true
+	}
+
+	// Hand out a copy so callers cannot change the cached entry
+	url := entry.url
+	return &url, false
+}
+
+func (s *LRUURLStore) Set(ctx context.Context, url *store.URL) error {
+	return s.SetMany(ctx, []*store.URL{url})
+}
+
+func (s *LRUURLStore) SetMany(ctx context.Context, urls []*store.URL) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, url := range urls {
+		exp := entryTTL(url, s.ttl)
+		if exp <= 0 {
+			continue
+		}
+
+		// Only dedupable links are returned for a plain shorten of the same long URL
+		if url.Dedupable() {
+			longURLHash := store.ComputeHash(url.LongURL)
+			s.add(&lruEntry{key: longURLKey(url.OwnerID, url.Domain, longURLHash), url: *url, expiresAt: now.Add(exp)})
+		}
+		s.add(&lruEntry{key: shortURLKey(url.Domain, url.ShortURL), url: *url, expiresAt: now.Add(exp)})
+	}
+
+	return nil
+}
+
+func (s *LRUURLStore) Delete(ctx context.Context, url *store.URL) error {
+	s.evict(urlKeys(url)...)
+	return nil
+}
+
+// evict drops the entries of keys.
+func (s *LRUURLStore) evict(keys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		if el, ok := s.items[key]; ok {
+			s.removeElement(el)
+		}
+	}
+}
+
+// LockLongURL always succeeds right away. An in-process cache only serves a
+// single replica, where concurrent shortens are already serialized by the
+// handler and the database unique index.
+func (s *LRUURLStore) LockLongURL(ctx context.Context, ownerID uint64, domain, longURLHash string) (func(), error) {
+	return func() {}, nil
+}
+
+// DecrClicks never finds a counter, leaving click limits to the database
+// which already serves a single replica well.
+func (s *LRUURLStore) DecrClicks(ctx context.Context, domain, shortURL string) (int64, bool, error) {
+	return 0, false, nil
+}
+
+func (s *LRUURLStore) SetClicks(ctx context.Context, url *store.URL, left int64) error {
+	return nil
+}
+
+func (s *LRUURLStore) DeleteClicks(ctx context.Context, domain, shortURL string) error {
+	return nil
+}
+
+func (s *LRUURLStore) add(entry *lruEntry) {
+	if el, ok := s.items[entry.key]; ok {
+		el.Value = entry
+		s.ll.MoveToFront(el)
+		return
+	}
+
+	s.items[entry.key] = s.ll.PushFront(entry)
+
+	for s.ll.Len() > s.size {
+		s.removeElement(s.ll.Back())
+	}
+}
+
+func (s *LRUURLStore) removeElement(el *list.Element) {
+	s.ll.Remove(el)
+	delete(s.items, el.Value.(*lruEntry).key)
+}
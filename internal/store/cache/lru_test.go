@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/huynguyenanh2000/url-shorterner/internal/store"
+)
+
+func TestLRUURLStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should return cached URLs by short and long URL", func(t *testing.T) {
+		s := NewLRUURLStore(10, time.Minute, time.Minute)
+		url := &store.URL{ID: 1, OwnerID: 1, ShortURL: "abc", LongURL: "https://google.com"}
+
+		if err := s.Set(ctx, url); err != nil {
+			t.Fatal(err)
+		}
+
+		if got, _ := s.GetByShortURL(ctx, "", "abc"); got == nil || got.LongURL != url.LongURL {
+			t.Errorf("expected cache hit by short URL, got %v", got)
+		}
+		if got, _ := s.GetByLongURLHash(ctx, 1, "", store.ComputeHash(url.LongURL)); got == nil || got.ShortURL != url.ShortURL {
+			t.Errorf("expected cache hit by long URL hash, got %v", got)
+		}
+		if got, _ := s.GetByLongURLHash(ctx, 2, "", store.ComputeHash(url.LongURL)); got != nil {
+			t.Errorf("expected cache miss for another owner, got %v", got)
+		}
+		if got, _ := s.GetByShortURL(ctx, "acme.link", "abc"); got != nil {
+			t.Errorf("expected cache miss on another domain, got %v", got)
+		}
+	})
+
+	t.Run("should evict the least recently used entry", func(t *testing.T) {
+		s := NewLRUURLStore(2, time.Minute, time.Minute)
+		custom := func(code string) *store.URL {
+			return &store.URL{ShortURL: code, LongURL: "https://google.com/" + code, IsCustom: true}
+		}
+
+		_ = s.Set(ctx, custom("a"))
+		_ = s.Set(ctx, custom("b"))
+		_, _ = s.GetByShortURL(ctx, "", "a")
+		_ = s.Set(ctx, custom("c"))
+
+		if got, _ := s.GetByShortURL(ctx, "", "b"); got != nil {
+			t.Errorf("expected b to be evicted")
+		}
+		if got, _ := s.GetByShortURL(ctx, "", "a"); got == nil {
+			t.Errorf("expected a to be kept")
+		}
+	})
+
+	t.Run("should not return expired or deleted entries", func(t *testing.T) {
+		s := NewLRUURLStore(10, time.Minute, time.Minute)
+
+		expiresAt := time.Now().Add(-time.Second)
+		_ = s.Set(ctx, &store.URL{ShortURL: "old", LongURL: "https://google.com", ExpiresAt: &expiresAt})
+		if got, _ := s.GetByShortURL(ctx, "", "old"); got != nil {
+			t.Errorf("expected expired link not to be cached")
+		}
+
+		url := &store.URL{ShortURL: "abc", LongURL: "https://google.com"}
+		_ = s.Set(ctx, url)
+		_ = s.Delete(ctx, url)
+		if got, _ := s.GetByShortURL(ctx, "", "abc"); got != nil {
+			t.Errorf("expected deleted link not to be cached")
+		}
+	})
+
+	t.Run("should remember missing short URLs until they are created", func(t *testing.T) {
+		s := NewLRUURLStore(10, time.Minute, time.Minute)
+
+		_ = s.SetMissing(ctx, "", "abc")
+		if _, err := s.GetByShortURL(ctx, "", "abc"); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("expected abc to be known missing, got %v", err)
+		}
+		if _, err := s.GetByShortURL(ctx, "acme.link", "abc"); err != nil {
+			t.Errorf("expected abc on another domain not to be known missing, got %v", err)
+		}
+
+		url := &store.URL{ShortURL: "abc", LongURL: "https://google.com"}
+		_ = s.Set(ctx, url)
+		_ = s.SetMissing(ctx, "", "abc")
+		if got, err := s.GetByShortURL(ctx, "", "abc"); err != nil || got == nil {
+			t.Errorf("expected the created link to win, got %v, %v", got, err)
+		}
+	})
+}
@@ -17,23 +17,61 @@ type MockURLStore struct {
 	mock.Mock
 }
 
-func (m *MockURLStore) GetByLongURLHash(ctx context.Context, longURLHash string) (*store.URL, error) {
-	args := m.Called(ctx, longURLHash)
+func (m *MockURLStore) GetByLongURLHash(ctx context.Context, ownerID uint64, domain, longURLHash string) (*store.URL, error) {
+	args := m.Called(ctx, ownerID, domain, longURLHash)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*store.URL), args.Error(1)
 }
 
-func (m *MockURLStore) GetByShortURL(ctx context.Context, shortURL string) (*store.URL, error) {
-	args := m.Called(ctx, shortURL)
+func (m *MockURLStore) GetByShortURL(ctx context.Context, domain, shortURL string) (*store.URL, error) {
+	args := m.Called(ctx, domain, shortURL)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*store.URL), args.Error(1)
 }
 
+func (m *MockURLStore) SetMissing(ctx context.Context, domain, shortURL string) error {
+	args := m.Called(ctx, domain, shortURL)
+	return args.Error(0)
+}
+
 func (m *MockURLStore) Set(ctx context.Context, url *store.URL) error {
 	args := m.Called(ctx, url)
 	return args.Error(0)
 }
+
+func (m *MockURLStore) SetMany(ctx context.Context, urls []*store.URL) error {
+	args := m.Called(ctx, urls)
+	return args.Error(0)
+}
+
+func (m *MockURLStore) Delete(ctx context.Context, url *store.URL) error {
+	args := m.Called(ctx, url)
+	return args.Error(0)
+}
+
+func (m *MockURLStore) LockLongURL(ctx context.Context, ownerID uint64, domain, longURLHash string) (func(), error) {
+	args := m.Called(ctx, ownerID, domain, longURLHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(func()), args.Error(1)
+}
+
+func (m *MockURLStore) DecrClicks(ctx context.Context, domain, shortURL string) (int64, bool, error) {
+	args := m.Called(ctx, domain, shortURL)
+	return args.Get(0).(int64), args.Bool(1), args.Error(2)
+}
+
+func (m *MockURLStore) SetClicks(ctx context.Context, url *store.URL, left int64) error {
+	args := m.Called(ctx, url, left)
+	return args.Error(0)
+}
+
+func (m *MockURLStore) DeleteClicks(ctx context.Context, domain, shortURL string) error {
+	args := m.Called(ctx, domain, shortURL)
+	return args.Error(0)
+}
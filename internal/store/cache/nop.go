@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/huynguyenanh2000/url-shorterner/internal/store"
+)
+
+// NopURLStore is a cache that never holds anything.
+type NopURLStore struct{}
+
+func (s *NopURLStore) GetByLongURLHash(ctx context.Context, ownerID uint64, domain, longURLHash string) (*store.URL, error) {
+	return nil, nil
+}
+
+func (s *NopURLStore) GetByShortURL(ctx context.Context, domain, shortURL string) (*store.URL, error) {
+	return nil, nil
+}
+
+func (s *NopURLStore) SetMissing(ctx context.Context, domain, shortURL string) error {
+	return nil
+}
+
+func (s *NopURLStore) Set(ctx context.Context, url *store.URL) error {
+	return nil
+}
+
+func (s *NopURLStore) SetMany(ctx context.Context, urls []*store.URL) error {
+	return nil
+}
+
+func (s *NopURLStore) Delete(ctx context.Context, url *store.URL) error {
+	return nil
+}
+
+// LockLongURL always succeeds right away, leaving concurrent shortens to the
+// handler and the database unique index.
+func (s *NopURLStore) LockLongURL(ctx context.Context, ownerID uint64, domain, longURLHash string) (func(), error) {
+	return func() {}, nil
+}
+
+func (s *NopURLStore) DecrClicks(ctx context.Context, domain, shortURL string) (int64, bool, error) {
+	return 0, false, nil
+}
+
+func (s *NopURLStore) SetClicks(ctx context.Context, url *store.URL, left int64) error {
+	return nil
+}
+
+func (s *NopURLStore) DeleteClicks(ctx context.Context, domain, shortURL string) error {
+	return nil
+}
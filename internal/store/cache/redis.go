@@ -1,11 +1,23 @@
 package cache
 
-import "github.com/redis/go-redis/v9"
+import (
+	"github.com/redis/go-redis/extra/redisotel/v9"
+	"github.com/redis/go-redis/v9"
+)
 
-func NewRedisClient(addr, pw string, db int) *redis.Client {
-	return redis.NewClient(&redis.Options{
+// NewRedisClient returns a Redis client whose commands are traced with the
+// global tracer provider.
+func NewRedisClient(addr, pw string, db int) (*redis.Client, error) {
+	rdb := redis.NewClient(&redis.Options{
 		Addr:     addr,
 		Password: pw,
 		DB:       db,
 	})
+
+	if err := redisotel.InstrumentTracing(rdb); err != nil {
+		rdb.Close()
+		return nil, err
+	}
+
+	return rdb, nil
 }
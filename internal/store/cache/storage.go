@@ -2,6 +2,8 @@ package cache
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/huynguyenanh2000/url-shorterner/internal/store"
 	"github.com/redis/go-redis/v9"
@@ -9,14 +11,86 @@ import (
 
 type Storage struct {
 	URL interface {
-		GetByLongURLHash(context.Context, string) (*store.URL, error)
-		GetByShortURL(context.Context, string) (*store.URL, error)
+		GetByLongURLHash(context.Context, uint64, string, string) (*store.URL, error)
+		GetByShortURL(context.Context, string, string) (*store.URL, error)
+		SetMissing(context.Context, string, string) error
 		Set(context.Context, *store.URL) error
+		SetMany(context.Context, []*store.URL) error
+		Delete(context.Context, *store.URL) error
+		LockLongURL(context.Context, uint64, string, string) (func(), error)
+		DecrClicks(context.Context, string, string) (int64, bool, error)
+		SetClicks(context.Context, *store.URL, int64) error
+		DeleteClicks(context.Context, string, string) error
 	}
 }
 
-func NewRedisStorage(rdb *redis.Client) Storage {
+// NewRedisStorage returns a cache shared by all replicas. Short URLs found
+// missing are remembered for negativeTTL, 0 disables it.
+func NewRedisStorage(rdb *redis.Client, negativeTTL time.Duration) Storage {
 	return Storage{
-		URL: &URLStore{rdb: rdb},
+		URL: &URLStore{rdb: rdb, negativeTTL: negativeTTL},
 	}
 }
+
+// NewTieredStorage returns a Redis cache fronted by an in-process one of up
+// to localSize entries kept for localTTL, which listens for invalidations
+// until ctx is done.
+func NewTieredStorage(ctx context.Context, rdb *redis.Client, negativeTTL time.Duration, localSize int, localTTL time.Duration) Storage {
+	s := NewTieredURLStore(rdb, negativeTTL, localSize, localTTL)
+	go s.Listen(ctx)
+
+	return Storage{
+		URL: s,
+	}
+}
+
+// NewLRUStorage returns an in-process cache holding up to size entries for
+// at most ttl each, or negativeTTL for short URLs found missing. It is meant
+// for deployments running a single replica without Redis.
+func NewLRUStorage(size int, ttl, negativeTTL time.Duration) Storage {
+	return Storage{
+		URL: NewLRUURLStore(size, ttl, negativeTTL),
+	}
+}
+
+// NewNopStorage returns a cache that stores nothing, so every lookup goes to
+// the database.
+func NewNopStorage() Storage {
+	return Storage{
+		URL: &NopURLStore{},
+	}
+}
+
+func shortURLKey(domain, shortURL string) string {
+	return fmt.Sprintf("url:s:%s", scoped(domain, shortURL))
+}
+
+func clicksKey(domain, shortURL string) string {
+	return fmt.Sprintf("url:c:%s", scoped(domain, shortURL))
+}
+
+// longURLKey scopes long URL lookups to an owner, since dedupe never returns
+// another owner's link.
+func longURLKey(ownerID uint64, domain, longURLHash string) string {
+	return fmt.Sprintf("url:l:%d:%s", ownerID, scoped(domain, longURLHash))
+}
+
+// scoped prefixes the keys of links on a branded domain with the domain.
+// Keys of the default domain are left as they were before domains existed.
+func scoped(domain, key string) string {
+	if domain == "" {
+		return key
+	}
+
+	return domain + ":" + key
+}
+
+// entryTTL caps maxTTL at the expiry of url, so a link is never served from
+// cache after it expired. A non-positive result means url must not be cached.
+func entryTTL(url *store.URL, maxTTL time.Duration) time.Duration {
+	if url.ExpiresAt == nil {
+		return maxTTL
+	}
+
+	return min(maxTTL, time.Until(*url.ExpiresAt))
+}
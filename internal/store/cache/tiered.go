@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/huynguyenanh2000/url-shorterner/internal/store"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+)
+
+// TieredURLStore serves URLs from a small in-process cache in front of the
+// Redis one, so that hot links skip the network. Concurrent misses of a key
+// share a single Redis lookup. Local copies are dropped on every replica when
+// Redis publishes that a URL changed, and expire after a short TTL in case an
+// invalidation is missed, e.g. while reconnecting.
+//
+// Click counters and locks are shared state and always go to Redis.
+type TieredURLStore struct {
+	*URLStore
+	local *LRUURLStore
+	group singleflight.Group
+
+	// mu guards generation, the number of invalidations received, so that
+	// a lookup racing with one does not keep what it read before it
+	mu         sync.Mutex
+	generation uint64
+}
+
+func NewTieredURLStore(rdb *redis.Client, negativeTTL time.Duration, localSize int, localTTL time.Duration) *TieredURLStore {
+	return &TieredURLStore{
+		URLStore: &URLStore{rdb: rdb, negativeTTL: negativeTTL},
+		local:    NewLRUURLStore(localSize, localTTL, min(negativeTTL, localTTL)),
+	}
+}
+
+func (s *TieredURLStore) GetByLongURLHash(ctx context.Context, ownerID uint64, domain, longURLHash string) (*store.URL, error) {
+	if url, err := s.local.GetByLongURLHash(ctx, ownerID, domain, longURLHash); url != nil || err != nil {
+		return url, err
+	}
+
+	return s.load(ctx, longURLKey(ownerID, domain, longURLHash), func(ctx context.Context) (*store.URL, error) {
+		return s.URLStore.GetByLongURLHash(ctx, ownerID, domain, longURLHash)
+	})
+}
+
+func (s *TieredURLStore) GetByShortURL(ctx context.Context, domain, shortURL string) (*store.URL, error) {
+	if url, err := s.local.GetByShortURL(ctx, domain, shortURL); url != nil || err != nil {
+		return url, err
+	}
+
+	return s.load(ctx, shortURLKey(domain, shortURL), func(ctx context.Context) (*store.URL, error) {
+		return s.URLStore.GetByShortURL(ctx, domain, shortURL)
+	})
+}
+
+// load looks key up in Redis once for all concurrent callers, keeping what
+// it finds locally, including that a short URL is known missing. Each caller
+// gets its own copy of the URL.
+func (s *TieredURLStore) load(ctx context.Context, key string, get func(context.Context) (*store.URL, error)) (*store.URL, error) {
+	v, err, _ := s.group.Do(key, func() (any, error) {
+		s.mu.Lock()
+		generation := s.generation
+		s.mu.Unlock()
+
+		// Callers that joined must not fail because the first one gave up
+		url, err := get(context.WithoutCancel(ctx))
+		s.keepLocal(ctx, generation, key, url, err)
+		return url, err
+	})
+
+	url, _ := v.(*store.URL)
+	if url == nil {
+		return nil, err
+	}
+
+	cp := *url
+	return &cp, err
+}
+
+// keepLocal keeps the result of looking key up in Redis locally, unless an
+// invalidation was received since generation, in which case it may predate
+// it.
+func (s *TieredURLStore) keepLocal(ctx context.Context, generation uint64, key string, url *store.URL, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.generation != generation {
+		return
+	}
+
+	switch {
+	case url != nil:
+		_ = s.local.Set(ctx, url)
+	case errors.Is(err, store.ErrNotFound):
+		s.local.setMissing(key)
+	}
+}
+
+func (s *TieredURLStore) SetMissing(ctx context.Context, domain, shortURL string) error {
+	if err := s.URLStore.SetMissing(ctx, domain, shortURL); err != nil {
+		return err
+	}
+
+	return s.local.SetMissing(ctx, domain, shortURL)
+}
+
+func (s *TieredURLStore) Set(ctx context.Context, url *store.URL) error {
+	return s.SetMany(ctx, []*store.URL{url})
+}
+
+func (s *TieredURLStore) SetMany(ctx context.Context, urls []*store.URL) error {
+	if err := s.URLStore.SetMany(ctx, urls); err != nil {
+		return err
+	}
+
+	return s.local.SetMany(ctx, urls)
+}
+
+func (s *TieredURLStore) Delete(ctx context.Context, url *store.URL) error {
+	if err := s.URLStore.Delete(ctx, url); err != nil {
+		return err
+	}
+
+	return s.local.Delete(ctx, url)
+}
+
+// Listen drops local copies of the URLs Redis publishes as changed, until
+// ctx is done. Replicas also receive their own invalidations, which only
+// costs them a Redis lookup.
+func (s *TieredURLStore) Listen(ctx context.Context) {
+	pubsub := s.rdb.Subscribe(ctx, invalidationChannel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			s.invalidate(msg.Payload)
+		}
+	}
+}
+
+func (s *TieredURLStore) invalidate(payload string) {
+	var keys []string
+	if err := json.Unmarshal([]byte(payload), &keys); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.generation++
+	s.local.evict(keys...)
+}
@@ -0,0 +1,196 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/huynguyenanh2000/url-shorterner/internal/store"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestReplicas returns two tiered stores sharing a Redis, like two
+// replicas of the API, both listening for invalidations.
+func newTestReplicas(t *testing.T) (*miniredis.Miniredis, *TieredURLStore, *TieredURLStore) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	a := NewTieredURLStore(rdb, time.Minute, 10, time.Minute)
+	b := NewTieredURLStore(rdb, time.Minute, 10, time.Minute)
+	go a.Listen(ctx)
+	go b.Listen(ctx)
+
+	waitFor(t, "replicas to subscribe", func() bool {
+		return mr.PubSubNumSub(invalidationChannel)[invalidationChannel] == 2
+	})
+
+	return mr, a, b
+}
+
+// seed caches url in Redis without publishing an invalidation, which would
+// race with the lookups of the test.
+func seed(t *testing.T, mr *miniredis.Miniredis, url *store.URL) {
+	t.Helper()
+
+	data, err := json.Marshal(cachedURL{URL: url})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mr.Set(shortURLKey(url.Domain, url.ShortURL), string(data)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestTieredURLStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should serve URLs locally once loaded from Redis", func(t *testing.T) {
+		mr, _, b := newTestReplicas(t)
+		url := &store.URL{ShortURL: "abc", LongURL: "https://google.com", IsCustom: true}
+
+		seed(t, mr, url)
+
+		if got, err := b.GetByShortURL(ctx, "", "abc"); err != nil || got == nil || got.LongURL != url.LongURL {
+			t.Fatalf("expected abc to be loaded from Redis, got %v, %v", got, err)
+		}
+
+		// Changed behind the back of the replicas, without an invalidation
+		mr.Del(shortURLKey("", "abc"))
+
+		if got, _ := b.GetByShortURL(ctx, "", "abc"); got == nil || got.LongURL != url.LongURL {
+			t.Errorf("expected abc to be served locally, got %v", got)
+		}
+	})
+
+	t.Run("should drop local copies when another replica updates a URL", func(t *testing.T) {
+		mr, a, b := newTestReplicas(t)
+		url := &store.URL{ShortURL: "abc", LongURL: "https://google.com", IsCustom: true}
+
+		seed(t, mr, url)
+		if got, _ := b.GetByShortURL(ctx, "", "abc"); got == nil {
+			t.Fatal("expected abc to be loaded from Redis")
+		}
+
+		updated := *url
+		updated.LongURL = "https://google.com/updated"
+		if err := a.Set(ctx, &updated); err != nil {
+			t.Fatal(err)
+		}
+
+		waitFor(t, "the update to reach the other replica", func() bool {
+			got, _ := b.GetByShortURL(ctx, "", "abc")
+			return got != nil && got.LongURL == updated.LongURL
+		})
+	})
+
+	t.Run("should drop local copies when another replica deletes a URL", func(t *testing.T) {
+		mr, a, b := newTestReplicas(t)
+		url := &store.URL{ShortURL: "abc", LongURL: "https://google.com", IsCustom: true}
+
+		seed(t, mr, url)
+		if got, _ := b.GetByShortURL(ctx, "", "abc"); got == nil {
+			t.Fatal("expected abc to be loaded from Redis")
+		}
+
+		if err := a.Delete(ctx, url); err != nil {
+			t.Fatal(err)
+		}
+
+		waitFor(t, "the delete to reach the other replica", func() bool {
+			got, err := b.GetByShortURL(ctx, "", "abc")
+			return got == nil && err == nil
+		})
+	})
+
+	t.Run("should remember short URLs known missing locally", func(t *testing.T) {
+		mr, a, b := newTestReplicas(t)
+
+		if err := a.SetMissing(ctx, "", "gone"); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := b.GetByShortURL(ctx, "", "gone"); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+
+		mr.Del(shortURLKey("", "gone"))
+
+		if _, err := b.GetByShortURL(ctx, "", "gone"); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("expected the miss to be served locally, got %v", err)
+		}
+	})
+
+	t.Run("should look a key up in Redis once for concurrent callers", func(t *testing.T) {
+		_, a, _ := newTestReplicas(t)
+		url := &store.URL{ShortURL: "abc", LongURL: "https://google.com", IsCustom: true}
+
+		var lookups atomic.Int32
+		release := make(chan struct{})
+		get := func(context.Context) (*store.URL, error) {
+			lookups.Add(1)
+			<-release
+			return url, nil
+		}
+
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if got, err := a.load(ctx, shortURLKey("", "abc"), get); err != nil || got == nil {
+					t.Errorf("expected abc, got %v, %v", got, err)
+				}
+			}()
+		}
+
+		// Let every caller join the first lookup
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		if n := lookups.Load(); n != 1 {
+			t.Errorf("expected a single lookup, got %d", n)
+		}
+	})
+
+	t.Run("should not keep a URL read before an invalidation", func(t *testing.T) {
+		_, a, _ := newTestReplicas(t)
+		url := &store.URL{ShortURL: "abc", LongURL: "https://google.com", IsCustom: true}
+
+		got, err := a.load(ctx, shortURLKey("", "abc"), func(context.Context) (*store.URL, error) {
+			// The URL changes while the lookup is on its way back
+			a.invalidate(`["` + shortURLKey("", "abc") + `"]`)
+			return url, nil
+		})
+		if err != nil || got == nil {
+			t.Fatalf("expected the caller to get abc, got %v, %v", got, err)
+		}
+
+		if got, _ := a.local.GetByShortURL(ctx, "", "abc"); got != nil {
+			t.Errorf("expected abc not to be kept locally, got %v", got)
+		}
+	})
+}
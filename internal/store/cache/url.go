@@ -2,8 +2,10 @@ package cache
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"time"
 
 	"github.com/huynguyenanh2000/url-shorterner/internal/store"
@@ -11,21 +13,76 @@ import (
 )
 
 type URLStore struct {
-	rdb *redis.Client
+	rdb         *redis.Client
+	negativeTTL time.Duration
 }
 
 const URLExpTime = time.Hour * 24 * 7
 
-func (s *URLStore) GetByLongURLHash(ctx context.Context, longURLHash string) (*store.URL, error) {
-	cacheKey := fmt.Sprintf("url:l:%s", longURLHash)
+// invalidationChannel carries the keys of URLs that changed, as a JSON
+// array, so that replicas drop their local copies.
+const invalidationChannel = "url:invalidate"
+
+// missingEntry is cached for short URLs known not to exist. It is never
+// valid JSON, so it cannot be mistaken for a URL.
+const missingEntry = "!"
+
+const (
+	// lockTTL bounds how long a crashed holder can keep a lock
+	lockTTL           = time.Second * 5
+	lockWait          = time.Second * 2
+	lockRetryInterval = time.Millisecond * 25
+)
+
+var ErrLockNotAcquired = errors.New("lock not acquired")
+
+// unlockScript only deletes the lock if it is still held with our token, so
+// a lock that expired and was taken over is never released by mistake.
+var unlockScript = redis.NewScript(`
+	if redis.call("GET", KEYS[1]) == ARGV[1] then
+		return redis.call("DEL", KEYS[1])
+	end
+	return 0
+`)
+
+// decrClicksScript only decrements counters that exist, so that a missing
+// counter is initialized from the database instead of going negative.
+var decrClicksScript = redis.NewScript(`
+	if redis.call("EXISTS", KEYS[1]) == 1 then
+		return redis.call("DECR", KEYS[1])
+	end
+	return false
+`)
+
+// cachedURL is the cache encoding of a URL. It keeps the fields that are
+// hidden from API responses, like the password hash.
+type cachedURL struct {
+	*store.URL
+	PasswordHash string `json:"password_hash,omitempty"`
+}
+
+func (s *URLStore) GetByLongURLHash(ctx context.Context, ownerID uint64, domain, longURLHash string) (*store.URL, error) {
+	cacheKey := longURLKey(ownerID, domain, longURLHash)
 	return s.get(ctx, cacheKey)
 }
 
-func (s *URLStore) GetByShortURL(ctx context.Context, shortURL string) (*store.URL, error) {
-	cacheKey := fmt.Sprintf("url:s:%s", shortURL)
+// GetByShortURL returns store.ErrNotFound if the short URL is known not to
+// exist.
+func (s *URLStore) GetByShortURL(ctx context.Context, domain, shortURL string) (*store.URL, error) {
+	cacheKey := shortURLKey(domain, shortURL)
 	return s.get(ctx, cacheKey)
 }
 
+// SetMissing caches that a short URL does not exist for a short while. It
+// never replaces a cached URL, so a link created in the meantime wins.
+func (s *URLStore) SetMissing(ctx context.Context, domain, shortURL string) error {
+	if s.negativeTTL <= 0 {
+		return nil
+	}
+
+	return s.rdb.SetNX(ctx, shortURLKey(domain, shortURL), missingEntry, s.negativeTTL).Err()
+}
+
 func (s *URLStore) get(ctx context.Context, cacheKey string) (*store.URL, error) {
 	data, err := s.rdb.Get(ctx, cacheKey).Result()
 	if err == redis.Nil {
@@ -34,27 +91,158 @@ func (s *URLStore) get(ctx context.Context, cacheKey string) (*store.URL, error)
 		return nil, err
 	}
 
-	var url store.URL
-	if err := json.Unmarshal([]byte(data), &url); err != nil {
+	if data == missingEntry {
+		return nil, store.ErrNotFound
+	}
+
+	entry := cachedURL{URL: &store.URL{}}
+	if err := json.Unmarshal([]byte(data), &entry); err != nil {
 		return nil, err
 	}
+	entry.URL.PasswordHash = entry.PasswordHash
 
-	return &url, nil
+	return entry.URL, nil
 }
 
 func (s *URLStore) Set(ctx context.Context, url *store.URL) error {
-	data, err := json.Marshal(url)
-	if err != nil {
+	return s.SetMany(ctx, []*store.URL{url})
+}
+
+// SetMany caches all urls through a single pipeline.
+func (s *URLStore) SetMany(ctx context.Context, urls []*store.URL) error {
+	pipe := s.rdb.Pipeline()
+
+	var changed []string
+	for _, url := range urls {
+		data, err := json.Marshal(cachedURL{URL: url, PasswordHash: url.PasswordHash})
+		if err != nil {
+			return err
+		}
+
+		exp := entryTTL(url, URLExpTime)
+		if exp <= 0 {
+			continue
+		}
+
+		// Only dedupable links are returned for a plain shorten of the same long URL
+		if url.Dedupable() {
+			longURLHash := store.ComputeHash(url.LongURL)
+			pipe.Set(ctx, longURLKey(url.OwnerID, url.Domain, longURLHash), data, exp)
+		}
+		pipe.Set(ctx, shortURLKey(url.Domain, url.ShortURL), data, exp)
+		changed = append(changed, urlKeys(url)...)
+	}
+
+	if pipe.Len() == 0 {
+		return nil
+	}
+
+	if err := publishInvalidation(ctx, pipe, changed); err != nil {
 		return err
 	}
 
-	longURLHash := store.ComputeHash(url.LongURL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
 
+// Delete removes both the short and long URL keys of url.
+func (s *URLStore) Delete(ctx context.Context, url *store.URL) error {
 	pipe := s.rdb.Pipeline()
 
-	pipe.Set(ctx, fmt.Sprintf("url:l:%s", longURLHash), data, URLExpTime)
-	pipe.Set(ctx, fmt.Sprintf("url:s:%s", url.ShortURL), data, URLExpTime)
+	keys := urlKeys(url)
+	pipe.Del(ctx, append(keys, clicksKey(url.Domain, url.ShortURL))...)
+	if err := publishInvalidation(ctx, pipe, keys); err != nil {
+		return err
+	}
 
-	_, err = pipe.Exec(ctx)
+	_, err := pipe.Exec(ctx)
 	return err
 }
+
+// urlKeys returns the keys url is cached under.
+func urlKeys(url *store.URL) []string {
+	longURLHash := store.ComputeHash(url.LongURL)
+
+	return []string{
+		shortURLKey(url.Domain, url.ShortURL),
+		longURLKey(url.OwnerID, url.Domain, longURLHash),
+	}
+}
+
+// publishInvalidation queues on pipe the publication of keys that changed.
+func publishInvalidation(ctx context.Context, pipe redis.Pipeliner, keys []string) error {
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+
+	pipe.Publish(ctx, invalidationChannel, data)
+	return nil
+}
+
+// DecrClicks decrements the clicks left of a short URL shared by all
+// replicas, and returns what is left after it. It returns false if no
+// counter is cached for it.
+func (s *URLStore) DecrClicks(ctx context.Context, domain, shortURL string) (int64, bool, error) {
+	left, err := decrClicksScript.Run(ctx, s.rdb, []string{clicksKey(domain, shortURL)}).Int64()
+	if err == redis.Nil {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+
+	return left, true, nil
+}
+
+// SetClicks caches the clicks left of url, for as long as url itself may be
+// cached.
+func (s *URLStore) SetClicks(ctx context.Context, url *store.URL, left int64) error {
+	exp := entryTTL(url, URLExpTime)
+	if exp <= 0 {
+		return nil
+	}
+
+	return s.rdb.Set(ctx, clicksKey(url.Domain, url.ShortURL), left, exp).Err()
+}
+
+func (s *URLStore) DeleteClicks(ctx context.Context, domain, shortURL string) error {
+	return s.rdb.Del(ctx, clicksKey(domain, shortURL)).Err()
+}
+
+// LockLongURL acquires a lock shared by all replicas on the long URL of an
+// owner on domain, waiting up to lockWait for it. It returns
+// ErrLockNotAcquired if the lock is still held by someone else after that.
+func (s *URLStore) LockLongURL(ctx context.Context, ownerID uint64, domain, longURLHash string) (func(), error) {
+	key := "lock:" + longURLKey(ownerID, domain, longURLHash)
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	token := hex.EncodeToString(b)
+
+	deadline := time.Now().Add(lockWait)
+	for {
+		ok, err := s.rdb.SetNX(ctx, key, token, lockTTL).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			unlock := func() {
+				_ = unlockScript.Run(context.Background(), s.rdb, []string{key}, token).Err()
+			}
+			return unlock, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, ErrLockNotAcquired
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+const (
+	maxReferrerLength  = 2048
+	maxUserAgentLength = 512
+
+	// statsTopReferrers is the number of referrers returned in ClickStats.
+	statsTopReferrers = 10
+)
+
+type Click struct {
+	URLID     uint64
+	ShortURL  string
+	Referrer  string
+	UserAgent string
+	IP        string
+	ClickedAt time.Time
+}
+
+type DailyClicks struct {
+	Day    string `json:"day"`
+	Clicks int64  `json:"clicks"`
+}
+
+type ReferrerClicks struct {
+	Referrer string `json:"referrer"`
+	Clicks   int64  `json:"clicks"`
+}
+
+type ClickStats struct {
+	Total      int64            `json:"total"`
+	ByDay      []DailyClicks    `json:"by_day"`
+	ByReferrer []ReferrerClicks `json:"by_referrer"`
+}
+
+type ClickStore struct {
+	db *sql.DB
+}
+
+// CreateMany inserts all clicks with a single multi-row statement.
+func (s *ClickStore) CreateMany(ctx context.Context, clicks []*Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(`
+		INSERT INTO url_clicks (url_id, short_url, referrer, user_agent, ip, clicked_at)
+		VALUES `)
+
+	args := make([]any, 0, len(clicks)*6)
+	for i, c := range clicks {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString("(?, ?, ?, ?, ?, ?)")
+
+		args = append(
+			args,
+			c.URLID,
+			c.ShortURL,
+			truncate(c.Referrer, maxReferrerLength),
+			truncate(c.UserAgent, maxUserAgentLength),
+			c.IP,
+			c.ClickedAt.UTC(),
+		)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, sb.String(), args...)
+	return err
+}
+
+// GetStats returns the total clicks of a URL, its daily clicks since the
+// given time and its top referrers.
+func (s *ClickStore) GetStats(ctx context.Context, urlID uint64, since time.Time) (*ClickStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	stats := &ClickStats{
+		ByDay:      []DailyClicks{},
+		ByReferrer: []ReferrerClicks{},
+	}
+
+	query := `
+		SELECT COUNT(*)
+		FROM url_clicks
+		WHERE url_id = ?
+	`
+
+	if err := s.db.QueryRowContext(ctx, query, urlID).Scan(&stats.Total); err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT DATE(clicked_at) AS day, COUNT(*)
+		FROM url_clicks
+		WHERE url_id = ? AND clicked_at >= ?
+		GROUP BY day
+		ORDER BY day
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, urlID, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			day   time.Time
+			daily DailyClicks
+		)
+		if err := rows.Scan(&day, &daily.Clicks); err != nil {
+			return nil, err
+		}
+
+		daily.Day = day.Format(time.DateOnly)
+		stats.ByDay = append(stats.ByDay, daily)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT referrer, COUNT(*) AS clicks
+		FROM url_clicks
+		WHERE url_id = ?
+		GROUP BY referrer
+		ORDER BY clicks DESC
+		LIMIT ?
+	`
+
+	rows, err = s.db.QueryContext(ctx, query, urlID, statsTopReferrers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var referrer ReferrerClicks
+		if err := rows.Scan(&referrer.Referrer, &referrer.Clicks); err != nil {
+			return nil, err
+		}
+
+		stats.ByReferrer = append(stats.ByReferrer, referrer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// truncate returns s as valid UTF-8 of at most n characters, which is how
+// VARCHAR columns count. Header values are arbitrary bytes, and a single
+// invalid one would fail the insert of the whole batch.
+func truncate(s string, n int) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+
+	return s
+}
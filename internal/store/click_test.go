@@ -0,0 +1,34 @@
+package store
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		n    int
+		want string
+	}{
+		{"keeps short values", "curl/8.0", 16, "curl/8.0"},
+		{"cuts ASCII values", "Mozilla/5.0", 7, "Mozilla"},
+		{"counts multibyte characters once", "héllo wörld", 5, "héllo"},
+		{"never splits a character", "日本語", 2, "日本"},
+		{"replaces invalid bytes", "a\xffb\xc3", 10, "a�b�"},
+		{"replaces invalid bytes before cutting", "\xff\xfe\xfdabc", 2, "�a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncate(tt.in, tt.n)
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("expected valid UTF-8, got %q", got)
+			}
+		})
+	}
+}
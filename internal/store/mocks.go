@@ -2,13 +2,16 @@ package store
 
 import (
 	"context"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 )
 
 func NewMockStore() Storage {
 	return Storage{
-		URL: &MockURLStore{},
+		URL:     &MockURLStore{},
+		Clicks:  &MockClickStore{},
+		APIKeys: &MockAPIKeyStore{},
 	}
 }
 
@@ -21,18 +24,101 @@ func (s *MockURLStore) Create(ctx context.Context, url *URL) error {
 	return args.Error(0)
 }
 
-func (s *MockURLStore) GetByLongURL(ctx context.Context, longURL string) (*URL, error) {
-	args := s.Called(ctx, longURL)
+func (s *MockURLStore) CreateMany(ctx context.Context, urls []*URL) error {
+	args := s.Called(ctx, urls)
+	return args.Error(0)
+}
+
+func (s *MockURLStore) GetByLongURL(ctx context.Context, ownerID uint64, domain, longURL string) (*URL, error) {
+	args := s.Called(ctx, ownerID, domain, longURL)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*URL), args.Error(1)
+}
+
+func (s *MockURLStore) GetByID(ctx context.Context, id uint64) (*URL, error) {
+	args := s.Called(ctx, id)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*URL), args.Error(1)
 }
 
-func (s *MockURLStore) GetByShortURL(ctx context.Context, shortURL string) (*URL, error) {
-	args := s.Called(ctx, shortURL)
+func (s *MockURLStore) GetByShortURL(ctx context.Context, domain, shortURL string) (*URL, error) {
+	args := s.Called(ctx, domain, shortURL)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*URL), args.Error(1)
 }
+
+func (s *MockURLStore) List(ctx context.Context, ownerID uint64, cursor uint64, limit int) ([]*URL, error) {
+	args := s.Called(ctx, ownerID, cursor, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*URL), args.Error(1)
+}
+
+func (s *MockURLStore) Update(ctx context.Context, url *URL) error {
+	args := s.Called(ctx, url)
+	return args.Error(0)
+}
+
+func (s *MockURLStore) Delete(ctx context.Context, id uint64) error {
+	args := s.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (s *MockURLStore) ListAll(ctx context.Context, cursor uint64, limit int) ([]*URL, error) {
+	args := s.Called(ctx, cursor, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*URL), args.Error(1)
+}
+
+func (s *MockURLStore) Flag(ctx context.Context, id uint64, reason string) error {
+	args := s.Called(ctx, id, reason)
+	return args.Error(0)
+}
+
+func (s *MockURLStore) ConsumeClick(ctx context.Context, id uint64) (int, error) {
+	args := s.Called(ctx, id)
+	return args.Int(0), args.Error(1)
+}
+
+type MockClickStore struct {
+	mock.Mock
+}
+
+func (s *MockClickStore) CreateMany(ctx context.Context, clicks []*Click) error {
+	args := s.Called(ctx, clicks)
+	return args.Error(0)
+}
+
+func (s *MockClickStore) GetStats(ctx context.Context, urlID uint64, since time.Time) (*ClickStats, error) {
+	args := s.Called(ctx, urlID, since)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*ClickStats), args.Error(1)
+}
+
+type MockAPIKeyStore struct {
+	mock.Mock
+}
+
+func (s *MockAPIKeyStore) Create(ctx context.Context, key *APIKey) error {
+	args := s.Called(ctx, key)
+	return args.Error(0)
+}
+
+func (s *MockAPIKeyStore) GetByHash(ctx context.Context, keyHash string) (*APIKey, error) {
+	args := s.Called(ctx, keyHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*APIKey), args.Error(1)
+}
@@ -5,23 +5,53 @@ import (
 	"database/sql"
 	"errors"
 	"time"
+
+	"github.com/huynguyenanh2000/url-shorterner/internal/pkg/canonical"
 )
 
 var (
 	ErrNotFound          = errors.New("resource not found")
+	ErrConflict          = errors.New("resource already exists")
 	QueryTimeoutDuration = time.Second * 5
 )
 
 type Storage struct {
 	URL interface {
 		Create(context.Context, *URL) error
-		GetByLongURL(context.Context, string) (*URL, error)
-		GetByShortURL(context.Context, string) (*URL, error)
+		CreateMany(context.Context, []*URL) error
+		GetByLongURL(context.Context, uint64, string, string) (*URL, error)
+		GetByID(context.Context, uint64) (*URL, error)
+		GetByShortURL(context.Context, string, string) (*URL, error)
+		List(context.Context, uint64, uint64, int) ([]*URL, error)
+		ListAll(context.Context, uint64, int) ([]*URL, error)
+		Update(context.Context, *URL) error
+		Delete(context.Context, uint64) error
+		ConsumeClick(context.Context, uint64) (int, error)
+		Flag(context.Context, uint64, string) error
+	}
+	Clicks interface {
+		CreateMany(context.Context, []*Click) error
+		GetStats(context.Context, uint64, time.Time) (*ClickStats, error)
+	}
+	APIKeys interface {
+		Create(context.Context, *APIKey) error
+		GetByHash(context.Context, string) (*APIKey, error)
 	}
 }
 
-func NewStorage(db *sql.DB) Storage {
+// QueryObserver receives the duration of the queries of a store, by
+// operation.
+type QueryObserver interface {
+	ObserveQuery(op string, d time.Duration)
+}
+
+// NewStorage returns the MySQL storage. Long URLs are stored and looked up in
+// the canonical form of canon. Query durations of the URL store are reported
+// to observer, if not nil.
+func NewStorage(db *sql.DB, canon *canonical.Canonicalizer, observer QueryObserver) Storage {
 	return Storage{
-		URL: &URLStore{db},
+		URL:     &URLStore{db: db, canon: canon, observer: observer},
+		Clicks:  &ClickStore{db},
+		APIKeys: &APIKeyStore{db},
 	}
 }
@@ -5,83 +5,318 @@ import (
 	"crypto/sha1"
 	"database/sql"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/huynguyenanh2000/url-shorterner/internal/pkg/canonical"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// mysqlErrDuplicateEntry is returned by MySQL when an insert violates a unique index.
+	mysqlErrDuplicateEntry = 1062
+
+	// maxDedupeSeq bounds the number of distinct long URLs of an owner that
+	// may share a SHA-1 hash.
+	maxDedupeSeq = 8
+)
+
+var (
+	// ErrDuplicateLongURL is returned when a dedupable URL is stored while the
+	// owner already has one for the same long URL.
+	ErrDuplicateLongURL = errors.New("long url already shortened")
+
+	// ErrClicksExhausted is returned when a URL has no clicks left.
+	ErrClicksExhausted = errors.New("url has no clicks left")
+
+	errDedupeSlotTaken = errors.New("dedupe slot taken")
 )
 
 type URL struct {
-	ID        uint64    `json:"id"`
-	ShortURL  string    `json:"short_url"`
-	LongURL   string    `json:"long_url"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID            uint64     `json:"id"`
+	OwnerID       uint64     `json:"owner_id"`
+	Domain        string     `json:"domain"`
+	ShortURL      string     `json:"short_url"`
+	LongURL       string     `json:"long_url"`
+	IsCustom      bool       `json:"is_custom"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	RedirectType  int        `json:"redirect_type"`
+	PasswordHash  string     `json:"-"`
+	MaxClicks     *int       `json:"max_clicks"`
+	FlaggedReason string     `json:"flagged_reason,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// IsExpired reports whether the URL has an expiry that already passed.
+func (u *URL) IsExpired() bool {
+	return u.ExpiresAt != nil && !u.ExpiresAt.After(time.Now())
+}
+
+// Dedupable reports whether the URL may be returned for another shorten
+// request of the same long URL by the same owner. Vanity aliases, expiring,
+// password-protected links and links with their own redirect type are always
+// created on their own, like links limited to a number of clicks.
+func (u *URL) Dedupable() bool {
+	return !u.IsCustom && u.ExpiresAt == nil && u.RedirectType == 0 && !u.HasPassword() && u.MaxClicks == nil
+}
+
+// HasPassword reports whether the URL is gated by a password.
+func (u *URL) HasPassword() bool {
+	return u.PasswordHash != ""
+}
+
+// IsFlagged reports whether the destination of the URL was found unsafe.
+func (u *URL) IsFlagged() bool {
+	return u.FlaggedReason != ""
+}
+
+// SetPassword stores the bcrypt hash of password on the URL.
+func (u *URL) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	u.PasswordHash = string(hash)
+	return nil
+}
+
+// CheckPassword reports whether password matches the password of the URL.
+func (u *URL) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
 }
 
 type URLStore struct {
-	db *sql.DB
+	db       *sql.DB
+	canon    *canonical.Canonicalizer
+	observer QueryObserver
 }
 
+// observe starts timing an operation, reported when the returned func is
+// called.
+func (s *URLStore) observe(op string) func() {
+	if s.observer == nil {
+		return func() {}
+	}
+
+	start := time.Now()
+	return func() {
+		s.observer.ObserveQuery(op, time.Since(start))
+	}
+}
+
+// canonicalize rewrites the long URL of url to its canonical form, which is
+// what is hashed and deduplicated.
+func (s *URLStore) canonicalize(url *URL) error {
+	longURL, err := s.canon.URL(url.LongURL)
+	if err != nil {
+		return err
+	}
+
+	url.LongURL = longURL
+	return nil
+}
+
+// urlColumns are the columns read by scanURL, in order.
+const urlColumns = "id, owner_id, domain, short_url, long_url, is_custom, expires_at, redirect_type, password_hash, max_clicks, flagged_reason, created_at, updated_at"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanURL(row rowScanner) (*URL, error) {
+	url := &URL{}
+
+	err := row.Scan(
+		&url.ID,
+		&url.OwnerID,
+		&url.Domain,
+		&url.ShortURL,
+		&url.LongURL,
+		&url.IsCustom,
+		&url.ExpiresAt,
+		&url.RedirectType,
+		&url.PasswordHash,
+		&url.MaxClicks,
+		&url.FlaggedReason,
+		&url.CreatedAt,
+		&url.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return url, nil
+}
+
+// ComputeHash hashes a long URL as is. Long URLs are hashed in the canonical
+// form they are stored in, so callers must canonicalize them first.
 func ComputeHash(s string) string {
 	h := sha1.New()
 	h.Write([]byte(s))
 	return hex.EncodeToString(h.Sum(nil))
 }
 
+// Create inserts url. A dedupable URL is only inserted if the owner does not
+// have one for the same long URL yet, otherwise ErrDuplicateLongURL is
+// returned.
 func (s *URLStore) Create(ctx context.Context, url *URL) error {
+	defer s.observe("create")()
+
+	if err := s.canonicalize(url); err != nil {
+		return err
+	}
+
+	if !url.Dedupable() {
+		return s.insert(ctx, []*URL{url}, 0)
+	}
+
+	return s.claimDedupeSlot(ctx, url, func(seq int) error {
+		return s.insert(ctx, []*URL{url}, seq)
+	})
+}
+
+// CreateMany inserts all urls with a single multi-row statement. If any of
+// them is a duplicate it returns ErrDuplicateLongURL and inserts none, in
+// which case the caller should fall back to Create.
+func (s *URLStore) CreateMany(ctx context.Context, urls []*URL) error {
+	defer s.observe("create_many")()
+
+	for _, url := range urls {
+		if err := s.canonicalize(url); err != nil {
+			return err
+		}
+	}
+
+	err := s.insert(ctx, urls, 0)
+	if errors.Is(err, errDedupeSlotTaken) {
+		return ErrDuplicateLongURL
+	}
+
+	return err
+}
+
+// claimDedupeSlot calls write with increasing dedupe sequence numbers until
+// it succeeds. A taken slot belongs either to the same long URL, which is
+// reported as ErrDuplicateLongURL, or to another long URL with the same hash.
+func (s *URLStore) claimDedupeSlot(ctx context.Context, url *URL, write func(seq int) error) error {
+	for seq := range maxDedupeSeq {
+		err := write(seq)
+		if !errors.Is(err, errDedupeSlotTaken) {
+			return err
+		}
+
+		_, err = s.GetByLongURL(ctx, url.OwnerID, url.Domain, url.LongURL)
+		switch {
+		case err == nil:
+			return ErrDuplicateLongURL
+		case !errors.Is(err, ErrNotFound):
+			return err
+		}
+	}
+
+	return fmt.Errorf("too many long urls with hash %s", ComputeHash(url.LongURL))
+}
+
+// insert stores urls, giving dedupable ones the dedupe sequence number seq.
+func (s *URLStore) insert(ctx context.Context, urls []*URL, seq int) error {
+	if len(urls) == 0 {
+		return nil
+	}
+
 	now := time.Now().UTC()
-	url.CreatedAt = now
-	url.UpdatedAt = now
 
-	longURLHash := ComputeHash(url.LongURL)
+	var sb strings.Builder
+	sb.WriteString(`
+		INSERT INTO url (id, owner_id, domain, long_url_hash, dedupe_seq, short_url, long_url, is_custom, expires_at, redirect_type, password_hash, max_clicks, created_at, updated_at)
+		VALUES `)
 
-	query := `
-		INSERT INTO url (id, long_url_hash, short_url, long_url, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`
+	args := make([]any, 0, len(urls)*14)
+	for i, url := range urls {
+		url.CreatedAt = now
+		url.UpdatedAt = now
+
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString("(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+
+		args = append(
+			args,
+			url.ID,
+			url.OwnerID,
+			url.Domain,
+			ComputeHash(url.LongURL),
+			dedupeSeq(url, seq),
+			url.ShortURL,
+			url.LongURL,
+			url.IsCustom,
+			url.ExpiresAt,
+			url.RedirectType,
+			url.PasswordHash,
+			url.MaxClicks,
+			url.CreatedAt,
+			url.UpdatedAt,
+		)
+	}
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	_, err := s.db.ExecContext(
-		ctx,
-		query,
-		url.ID,
-		longURLHash,
-		url.ShortURL,
-		url.LongURL,
-		url.CreatedAt,
-		url.UpdatedAt,
-	)
-	if err != nil {
-		return err
+	_, err := s.db.ExecContext(ctx, sb.String(), args...)
+	return mapWriteError(err)
+}
+
+func dedupeSeq(url *URL, seq int) *int {
+	if !url.Dedupable() {
+		return nil
 	}
 
-	return nil
+	return &seq
 }
 
-func (s *URLStore) GetByLongURL(ctx context.Context, longURL string) (*URL, error) {
+func mapWriteError(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDuplicateEntry {
+		if strings.Contains(mysqlErr.Message, "idx_long_url_dedupe") {
+			return errDedupeSlotTaken
+		}
+		return ErrConflict
+	}
+
+	return err
+}
+
+// GetByLongURL returns the dedupable URL of an owner on domain for the given
+// long URL.
+func (s *URLStore) GetByLongURL(ctx context.Context, ownerID uint64, domain, longURL string) (*URL, error) {
+	defer s.observe("get_by_long_url")()
+
+	longURL, err := s.canon.URL(longURL)
+	if err != nil {
+		return nil, err
+	}
 	longURLHash := ComputeHash(longURL)
 
 	query := `
-		SELECT id, short_url, long_url, created_at, updated_at
+		SELECT ` + urlColumns + `
 		FROM url
-		WHERE long_url_hash = ? AND long_url = ?
+		WHERE long_url_hash = ? AND long_url = ? AND owner_id = ? AND domain = ? AND dedupe_seq IS NOT NULL
 		LIMIT 1
 	`
 
-	url := &URL{}
-
-	err := s.db.QueryRowContext(
+	url, err := scanURL(s.db.QueryRowContext(
 		ctx,
 		query,
 		longURLHash,
 		longURL,
-	).Scan(
-		&url.ID,
-		&url.ShortURL,
-		&url.LongURL,
-		&url.CreatedAt,
-		&url.UpdatedAt,
-	)
+		ownerID,
+		domain,
+	))
 	if err != nil {
 		switch err {
 		case sql.ErrNoRows:
@@ -94,27 +329,47 @@ func (s *URLStore) GetByLongURL(ctx context.Context, longURL string) (*URL, erro
 	return url, nil
 }
 
-func (s *URLStore) GetByShortURL(ctx context.Context, shortURL string) (*URL, error) {
+// GetByID returns the URL with the given ID.
+func (s *URLStore) GetByID(ctx context.Context, id uint64) (*URL, error) {
+	defer s.observe("get_by_id")()
+
 	query := `
-		SELECT id, short_url, long_url, created_at, updated_at
+		SELECT ` + urlColumns + `
 		FROM url
-		WHERE short_url = ?
-		LIMIT 1
+		WHERE id = ?
 	`
 
-	url := &URL{}
+	url, err := scanURL(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return url, nil
+}
+
+// GetByShortURL returns the URL served at shortURL on domain, empty for the
+// default domain.
+func (s *URLStore) GetByShortURL(ctx context.Context, domain, shortURL string) (*URL, error) {
+	defer s.observe("get_by_short_url")()
+
+	query := `
+		SELECT ` + urlColumns + `
+		FROM url
+		WHERE domain = ? AND short_url = ?
+		LIMIT 1
+	`
 
-	err := s.db.QueryRowContext(
+	url, err := scanURL(s.db.QueryRowContext(
 		ctx,
 		query,
+		domain,
 		shortURL,
-	).Scan(
-		&url.ID,
-		&url.ShortURL,
-		&url.LongURL,
-		&url.CreatedAt,
-		&url.UpdatedAt,
-	)
+	))
 	if err != nil {
 		switch err {
 		case sql.ErrNoRows:
@@ -126,3 +381,198 @@ func (s *URLStore) GetByShortURL(ctx context.Context, shortURL string) (*URL, er
 
 	return url, nil
 }
+
+// List returns up to limit URLs of an owner, newest first. When cursor is not
+// zero only URLs with a smaller ID are returned.
+func (s *URLStore) List(ctx context.Context, ownerID uint64, cursor uint64, limit int) ([]*URL, error) {
+	defer s.observe("list")()
+
+	return s.list(ctx, "owner_id = ?", []any{ownerID}, cursor, limit)
+}
+
+// ListAll lists the URLs of every owner, newest first.
+func (s *URLStore) ListAll(ctx context.Context, cursor uint64, limit int) ([]*URL, error) {
+	defer s.observe("list_all")()
+
+	return s.list(ctx, "TRUE", nil, cursor, limit)
+}
+
+func (s *URLStore) list(ctx context.Context, where string, args []any, cursor uint64, limit int) ([]*URL, error) {
+	var sb strings.Builder
+	sb.WriteString(`
+		SELECT ` + urlColumns + `
+		FROM url
+		WHERE ` + where)
+
+	if cursor != 0 {
+		sb.WriteString(" AND id < ?")
+		args = append(args, cursor)
+	}
+
+	sb.WriteString(`
+		ORDER BY id DESC
+		LIMIT ?`)
+	args = append(args, limit)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, sb.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	urls := []*URL{}
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		urls = append(urls, url)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+// Update changes the long URL of an existing URL. A dedupable URL cannot be
+// pointed at a long URL the owner already has another one for, in which case
+// ErrDuplicateLongURL is returned.
+func (s *URLStore) Update(ctx context.Context, url *URL) error {
+	defer s.observe("update")()
+
+	if err := s.canonicalize(url); err != nil {
+		return err
+	}
+	url.UpdatedAt = time.Now().UTC()
+
+	if !url.Dedupable() {
+		return s.update(ctx, url, 0)
+	}
+
+	return s.claimDedupeSlot(ctx, url, func(seq int) error {
+		return s.update(ctx, url, seq)
+	})
+}
+
+func (s *URLStore) update(ctx context.Context, url *URL, seq int) error {
+	query := `
+		UPDATE url
+		SET long_url = ?, long_url_hash = ?, dedupe_seq = ?, flagged_reason = ?, updated_at = ?
+		WHERE id = ?
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(
+		ctx,
+		query,
+		url.LongURL,
+		ComputeHash(url.LongURL),
+		dedupeSeq(url, seq),
+		url.FlaggedReason,
+		url.UpdatedAt,
+		url.ID,
+	)
+	if err != nil {
+		return mapWriteError(err)
+	}
+
+	return checkRowsAffected(res)
+}
+
+func (s *URLStore) Delete(ctx context.Context, id uint64) error {
+	defer s.observe("delete")()
+
+	query := `
+		DELETE FROM url
+		WHERE id = ?
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+// Flag records why the destination of the URL of id is unsafe. An empty
+// reason clears the flag.
+func (s *URLStore) Flag(ctx context.Context, id uint64, reason string) error {
+	defer s.observe("flag")()
+
+	query := `
+		UPDATE url
+		SET flagged_reason = ?, updated_at = ?
+		WHERE id = ?
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, reason, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+// ConsumeClick counts a click against the click limit of the URL of id, and
+// returns the number of clicks consumed so far. It returns ErrClicksExhausted if none
+// were left. The check and the increment are a single statement, so the limit
+// holds across all replicas.
+func (s *URLStore) ConsumeClick(ctx context.Context, id uint64) (int, error) {
+	defer s.observe("consume_click")()
+
+	// LAST_INSERT_ID(expr) hands the new count back without another query
+	query := `
+		UPDATE url
+		SET click_count = LAST_INSERT_ID(click_count + 1)
+		WHERE id = ? AND max_clicks IS NOT NULL AND click_count < max_clicks
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := checkRowsAffected(res); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return 0, ErrClicksExhausted
+		}
+		return 0, err
+	}
+
+	count, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(count), nil
+}
+
+func checkRowsAffected(res sql.Result) error {
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
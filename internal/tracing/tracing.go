@@ -0,0 +1,150 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type Config struct {
+	// One of otlp, stdout or none
+	Exporter string
+	// Collector URL of the otlp exporter. The standard OTEL_EXPORTER_OTLP_*
+	// variables apply when empty.
+	OTLPEndpoint string
+	// File the stdout exporter writes to, stdout when empty
+	File string
+	// Fraction of new traces to sample. Traces started upstream keep the
+	// sampling decision of their parent.
+	SampleRatio    float64
+	ServiceName    string
+	ServiceVersion string
+}
+
+// Setup installs the global tracer provider and the W3C trace context
+// propagator. The returned function flushes pending spans and must be called
+// before exiting. With the none exporter, spans are neither recorded nor
+// exported but trace context is still propagated.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var (
+		exporter sdktrace.SpanExporter
+		closer   io.Closer
+		err      error
+	)
+	switch cfg.Exporter {
+	case "none", "":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		var opts []otlptracehttp.Option
+		if cfg.OTLPEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.OTLPEndpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	case "stdout":
+		w := io.Writer(os.Stdout)
+		if cfg.File != "" {
+			f, ferr := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+			if ferr != nil {
+				return nil, ferr
+			}
+			w, closer = f, f
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(w))
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName(cfg.ServiceName),
+		semconv.ServiceVersion(cfg.ServiceVersion),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if closer != nil {
+			if cerr := closer.Close(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}, nil
+}
+
+// Middleware starts a server span for each request, continuing the trace of
+// the incoming traceparent header. Spans are named after the chi route
+// pattern once the request is routed, so that short codes do not each get
+// their own span name. Requests to the paths in skip are not traced.
+func Middleware(skip ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		routed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(spanName(r))
+			if route := routePattern(r); route != "" {
+				span.SetAttributes(semconv.HTTPRoute(route))
+			}
+		})
+
+		return otelhttp.NewHandler(routed, "HTTP",
+			otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+				return spanName(r)
+			}),
+			otelhttp.WithFilter(func(r *http.Request) bool {
+				for _, path := range skip {
+					if r.URL.Path == path {
+						return false
+					}
+				}
+				return true
+			}),
+		)
+	}
+}
+
+func spanName(r *http.Request) string {
+	if route := routePattern(r); route != "" {
+		return r.Method + " " + route
+	}
+
+	return r.Method
+}
+
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		return rctx.RoutePattern()
+	}
+
+	return ""
+}